@@ -0,0 +1,33 @@
+package session
+
+import (
+	"net"
+
+	net2 "github.com/mogud/snow/core/net"
+)
+
+var _ net2.IConnPreprocessor = (*Preprocessor)(nil)
+
+// Preprocessor 在节点连接上建立加密会话的预处理器，与认证预处理器组合时应置于 PreprocessorChain 的首位
+type Preprocessor struct {
+	opt      *Option
+	isClient bool
+}
+
+// NewPreprocessors 创建一对加密预处理器，分别用于连接发起方与接收方
+func NewPreprocessors(opt *Option) (client *Preprocessor, server *Preprocessor) {
+	return &Preprocessor{opt: opt, isClient: true}, &Preprocessor{opt: opt}
+}
+
+// Process 加密会话需替换连接，不能通过 Process 使用，始终返回 ErrProcessConnRequired 且不读写连接
+func (ss *Preprocessor) Process(net.Conn) error {
+	return net2.ErrProcessConnRequired
+}
+
+func (ss *Preprocessor) ProcessConn(conn net.Conn) (net.Conn, string, error) {
+	c, err := handshake(conn, ss.opt, ss.isClient)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, "", nil
+}
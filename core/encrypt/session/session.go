@@ -0,0 +1,247 @@
+// Package session 基于 X25519 密钥交换与 AES-256-GCM 的会话加密通道，
+// 可独立包装任意 net.Conn，也可作为节点连接的预处理器使用。
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFrameSize 单个加密帧承载的最大明文长度，更长的写入会被拆分为多个帧
+	MaxFrameSize = 16 * 1024
+
+	keyLen           = 32
+	frameHeaderLen   = 4
+	handshakeTimeout = 5 * time.Second
+)
+
+var handshakeMagic = []byte("SNOWSESS1")
+
+var (
+	ErrHandshake     = errors.New("session: handshake failed")
+	ErrFrameTooLarge = errors.New("session: frame too large")
+	ErrDecrypt       = errors.New("session: message authentication failed")
+)
+
+// Option 会话选项
+type Option struct {
+	// PreSharedKey 双方预共享的密钥，参与会话密钥派生，不一致时首个加密帧即校验失败，可防止中间人攻击；为空时仅提供被动窃听防护
+	PreSharedKey []byte
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+// Conn 加密会话连接，读写均线程安全
+type Conn struct {
+	net.Conn
+
+	rLock  sync.Mutex
+	rAead  cipher.AEAD
+	rSeq   uint64
+	rRaw   []byte // 尚未组成完整帧的密文
+	rPlain []byte // 已解密尚未读取的明文
+
+	wLock sync.Mutex
+	wAead cipher.AEAD
+	wSeq  uint64
+}
+
+// Client 作为发起方在 conn 上完成密钥交换，返回加密连接
+func Client(conn net.Conn, opt *Option) (*Conn, error) {
+	return handshake(conn, opt, true)
+}
+
+// Server 作为接收方在 conn 上完成密钥交换，返回加密连接
+func Server(conn net.Conn, opt *Option) (*Conn, error) {
+	return handshake(conn, opt, false)
+}
+
+// handshake 协议：
+//
+//	C -> S: magic + pubC
+//	S -> C: magic + pubS
+//
+// 双方以 X25519(priv, pubPeer) 为输入，pubC + pubS + PreSharedKey 为盐，经 HKDF-SHA256 分别派生两个方向的密钥
+func handshake(conn net.Conn, opt *Option, isClient bool) (*Conn, error) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	local := priv.PublicKey().Bytes()
+
+	hello := append(append([]byte{}, handshakeMagic...), local...)
+	peerHello := make([]byte, len(hello))
+	if isClient {
+		if _, err = conn.Write(hello); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(conn, peerHello); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = io.ReadFull(conn, peerHello); err != nil {
+			return nil, err
+		}
+		if _, err = conn.Write(hello); err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.Equal(peerHello[:len(handshakeMagic)], handshakeMagic) {
+		return nil, ErrHandshake
+	}
+	remote := peerHello[len(handshakeMagic):]
+
+	peerKey, err := ecdh.X25519().NewPublicKey(remote)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+	shared, err := priv.ECDH(peerKey)
+	if err != nil {
+		return nil, ErrHandshake
+	}
+
+	clientPub, serverPub := local, remote
+	if !isClient {
+		clientPub, serverPub = remote, local
+	}
+	salt := make([]byte, 0, len(clientPub)+len(serverPub)+len(opt.psk()))
+	salt = append(salt, clientPub...)
+	salt = append(salt, serverPub...)
+	salt = append(salt, opt.psk()...)
+
+	c2s, err := newAead(shared, salt, "snow session c2s")
+	if err != nil {
+		return nil, err
+	}
+	s2c, err := newAead(shared, salt, "snow session s2c")
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &Conn{Conn: conn}
+	if isClient {
+		ss.wAead, ss.rAead = c2s, s2c
+	} else {
+		ss.wAead, ss.rAead = s2c, c2s
+	}
+	return ss, nil
+}
+
+func (opt *Option) psk() []byte {
+	if opt == nil {
+		return nil
+	}
+	return opt.PreSharedKey
+}
+
+func newAead(shared, salt []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, shared, salt, info, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce 使用各方向独立递增的序号，同时防止帧重放与重排
+func nonce(aead cipher.AEAD, seq uint64) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(n[len(n)-8:], seq)
+	return n
+}
+
+// Write 加密写入，帧格式为 4 字节小端密文长度 + 密文
+func (ss *Conn) Write(b []byte) (int, error) {
+	ss.wLock.Lock()
+	defer ss.wLock.Unlock()
+
+	frames := (len(b) + MaxFrameSize - 1) / MaxFrameSize
+	buf := make([]byte, 0, len(b)+frames*(frameHeaderLen+ss.wAead.Overhead()))
+	for rest := b; len(rest) > 0; {
+		n := min(len(rest), MaxFrameSize)
+
+		start := len(buf)
+		buf = append(buf, 0, 0, 0, 0)
+		buf = ss.wAead.Seal(buf, nonce(ss.wAead, ss.wSeq), rest[:n], nil)
+		binary.LittleEndian.PutUint32(buf[start:], uint32(len(buf)-start-frameHeaderLen))
+		ss.wSeq++
+
+		rest = rest[n:]
+	}
+
+	if _, err := ss.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read 解密读取，读取超时等错误不会丢失已收到的部分密文，可在错误后继续读取
+func (ss *Conn) Read(b []byte) (int, error) {
+	ss.rLock.Lock()
+	defer ss.rLock.Unlock()
+
+	for len(ss.rPlain) == 0 {
+		ok, err := ss.decryptFrame()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			continue
+		}
+
+		buf := make([]byte, MaxFrameSize)
+		n, err := ss.Conn.Read(buf)
+		ss.rRaw = append(ss.rRaw, buf[:n]...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, ss.rPlain)
+	ss.rPlain = ss.rPlain[n:]
+	return n, nil
+}
+
+// decryptFrame 若已收到完整帧，则解密到明文缓冲
+func (ss *Conn) decryptFrame() (bool, error) {
+	if len(ss.rRaw) < frameHeaderLen {
+		return false, nil
+	}
+
+	l := int(binary.LittleEndian.Uint32(ss.rRaw))
+	if l > MaxFrameSize+ss.rAead.Overhead() {
+		return false, ErrFrameTooLarge
+	}
+	if len(ss.rRaw) < frameHeaderLen+l {
+		return false, nil
+	}
+
+	plain, err := ss.rAead.Open(nil, nonce(ss.rAead, ss.rSeq), ss.rRaw[frameHeaderLen:frameHeaderLen+l], nil)
+	if err != nil {
+		return false, ErrDecrypt
+	}
+	ss.rSeq++
+	ss.rRaw = ss.rRaw[frameHeaderLen+l:]
+	ss.rPlain = plain
+	return true, nil
+}
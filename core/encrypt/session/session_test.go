@@ -0,0 +1,136 @@
+package session_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mogud/snow/core/encrypt/session"
+	net2 "github.com/mogud/snow/core/net"
+	"github.com/stretchr/testify/assert"
+)
+
+type result struct {
+	conn net.Conn
+	err  error
+}
+
+func runPair(t *testing.T, clientP, serverP net2.IPreprocessor) (net.Conn, net.Conn, error, error) {
+	c, s := net.Pipe()
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = s.Close()
+	})
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, _, err := net2.Preprocess(serverP, s)
+		ch <- result{conn, err}
+	}()
+
+	cc, _, cErr := net2.Preprocess(clientP, c)
+	sr := <-ch
+	return cc, sr.conn, cErr, sr.err
+}
+
+func TestSession_RoundTrip(t *testing.T) {
+	client, server := session.NewPreprocessors(&session.Option{PreSharedKey: []byte("psk")})
+	cc, sc, cErr, sErr := runPair(t, client, server)
+	assert.NoError(t, cErr)
+	assert.NoError(t, sErr)
+
+	// 超过单帧长度的写入会被拆分
+	payload := bytes.Repeat([]byte("snow"), session.MaxFrameSize)
+	go func() {
+		_, _ = cc.Write(payload)
+	}()
+
+	got := make([]byte, len(payload))
+	_, err := io.ReadFull(sc, got)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	go func() {
+		_, _ = sc.Write([]byte("pong"))
+	}()
+	got = make([]byte, 4)
+	_, err = io.ReadFull(cc, got)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("pong"), got)
+}
+
+func TestSession_ReadTimeoutKeepsConn(t *testing.T) {
+	client, server := session.NewPreprocessors(nil)
+	cc, sc, cErr, sErr := runPair(t, client, server)
+	assert.NoError(t, cErr)
+	assert.NoError(t, sErr)
+
+	_ = sc.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := sc.Read(make([]byte, 4))
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout())
+
+	_ = sc.SetReadDeadline(time.Time{})
+	go func() {
+		_, _ = cc.Write([]byte("ping"))
+	}()
+	got := make([]byte, 4)
+	_, err = io.ReadFull(sc, got)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ping"), got)
+}
+
+func TestSession_PreSharedKeyMismatch(t *testing.T) {
+	client, _ := session.NewPreprocessors(&session.Option{PreSharedKey: []byte("a")})
+	_, server := session.NewPreprocessors(&session.Option{PreSharedKey: []byte("b")})
+	cc, sc, cErr, sErr := runPair(t, client, server)
+	assert.NoError(t, cErr)
+	assert.NoError(t, sErr)
+
+	go func() {
+		_, _ = cc.Write([]byte("ping"))
+	}()
+	_, err := sc.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, session.ErrDecrypt)
+}
+
+func TestSession_ChainWithAuth(t *testing.T) {
+	secret := []byte("cluster-secret")
+	sessC, sessS := session.NewPreprocessors(nil)
+	authC, _ := net2.NewAuthPreprocessors("node-a", secret, nil)
+	_, authS := net2.NewAuthPreprocessors("node-b", secret, nil)
+
+	c, s := net.Pipe()
+	defer func() {
+		_ = c.Close()
+		_ = s.Close()
+	}()
+
+	ch := make(chan string, 1)
+	go func() {
+		_, peer, _ := net2.Preprocess(net2.PreprocessorChain{sessS, authS}, s)
+		ch <- peer
+	}()
+
+	conn, peer, err := net2.Preprocess(net2.PreprocessorChain{sessC, authC}, c)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-b", peer)
+	assert.Equal(t, "node-a", <-ch)
+	assert.IsType(t, &session.Conn{}, conn)
+}
+
+func TestSession_ProcessRequiresProcessConn(t *testing.T) {
+	client, _ := session.NewPreprocessors(nil)
+	c, s := net.Pipe()
+	defer func() {
+		_ = c.Close()
+		_ = s.Close()
+	}()
+
+	// 旧的 Process 接口无法返回加密连接，直接失败而不是在握手后继续明文收发
+	assert.ErrorIs(t, client.Process(c), net2.ErrProcessConnRequired)
+	assert.ErrorIs(t, net2.PreprocessorChain{client}.Process(c), net2.ErrProcessConnRequired)
+}
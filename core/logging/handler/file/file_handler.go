@@ -172,6 +172,7 @@ func (ss *Handler) Log(logData *logging.LogData) {
 			File:     fn,
 			Line:     ln,
 			Level:    d.Level,
+			TraceID:  d.TraceID,
 			Custom:   d.Custom,
 			Message:  d.Message,
 		}
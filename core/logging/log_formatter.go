@@ -23,6 +23,11 @@ func (ss *LogFormatterContainer) GetFormatter(name string) func(logData *LogData
 	return ss.formatters[name]
 }
 
+// FormatTraceID 追踪 ID 的文本形式，固定 16 位 16 进制，日志与导出的 Span 均使用该格式
+func FormatTraceID(trace int64) string {
+	return fmt.Sprintf("%016x", uint64(trace))
+}
+
 func DefaultLogFormatter(logData *LogData) string {
 	sb := strings.Builder{}
 	now := logData.Time
@@ -61,6 +66,9 @@ func DefaultLogFormatter(logData *LogData) string {
 	if len(logData.File) != 0 {
 		sb.WriteString(fmt.Sprintf(" %s(%d)", logData.File, logData.Line))
 	}
+	if logData.TraceID != 0 {
+		sb.WriteString(" [" + FormatTraceID(logData.TraceID) + "]")
+	}
 	sb.WriteString(" ")
 	sb.WriteString(logData.Message())
 	return sb.String()
@@ -105,6 +113,9 @@ func ColorLogFormatter(logData *LogData) string {
 	if len(logData.File) != 0 {
 		sb.WriteString(fmt.Sprintf(" %s(%d)", logData.File, logData.Line))
 	}
+	if logData.TraceID != 0 {
+		sb.WriteString(" [" + FormatTraceID(logData.TraceID) + "]")
+	}
 	sb.WriteString(" ")
 	sb.WriteString(logData.Message())
 	sb.WriteString("\x1b[0m")
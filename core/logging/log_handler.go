@@ -15,6 +15,7 @@ type LogData struct {
 	File     string
 	Line     int
 	Level    Level
+	TraceID  int64 // 调用链追踪 ID，0 代表无
 	Custom   []any
 	Message  func() string
 }
@@ -0,0 +1,202 @@
+package net
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+const (
+	authNonceLen   = 32
+	authMaxNameLen = 255
+	authTimeout    = 5 * time.Second
+)
+
+var authMagic = []byte("SNOWAUTH1")
+
+var (
+	ErrAuthFailed      = errors.New("auth: authentication failed")
+	ErrAuthUnknownPeer = errors.New("auth: unknown peer")
+	ErrAuthRejected    = errors.New("auth: rejected by server")
+)
+
+var _ IPeerPreprocessor = (*AuthClientPreprocessor)(nil)
+var _ IPeerPreprocessor = (*AuthServerPreprocessor)(nil)
+
+// AuthClientPreprocessor 连接发起方的认证预处理器，基于预共享密钥完成双向挑战应答
+type AuthClientPreprocessor struct {
+	name   string
+	secret []byte
+}
+
+// AuthServerPreprocessor 连接接收方的认证预处理器，拒绝密钥错误或不在允许列表中的对端
+type AuthServerPreprocessor struct {
+	name         string
+	secret       []byte
+	allowedPeers []string
+}
+
+// NewAuthPreprocessors 创建一对认证预处理器，name 为当前节点身份，secret 为集群预共享密钥，
+// allowedPeers 为允许连接的对端名称，为空代表持有密钥的任意对端
+func NewAuthPreprocessors(name string, secret []byte, allowedPeers []string) (*AuthClientPreprocessor, *AuthServerPreprocessor) {
+	if len(name) == 0 || len(name) > authMaxNameLen {
+		panic(fmt.Sprintf("auth: invalid node name length %d", len(name)))
+	}
+	if len(secret) == 0 {
+		panic("auth: empty secret")
+	}
+
+	return &AuthClientPreprocessor{
+		name:   name,
+		secret: secret,
+	}, &AuthServerPreprocessor{
+		name:         name,
+		secret:       secret,
+		allowedPeers: allowedPeers,
+	}
+}
+
+func (ss *AuthClientPreprocessor) Process(conn net.Conn) error {
+	_, err := ss.ProcessPeer(conn)
+	return err
+}
+
+// ProcessPeer 协议：
+//
+//	S -> C: magic + nonceS
+//	C -> S: nonceC + len(name) + name + HMAC("client", nonceS, nonceC, name)
+//	S -> C: ok + len(nameS) + nameS + HMAC("server", nonceC, nonceS, nameS, name)
+func (ss *AuthClientPreprocessor) ProcessPeer(conn net.Conn) (string, error) {
+	_ = conn.SetDeadline(time.Now().Add(authTimeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	challenge := make([]byte, len(authMagic)+authNonceLen)
+	if _, err := io.ReadFull(conn, challenge); err != nil {
+		return "", err
+	}
+	if !hmac.Equal(challenge[:len(authMagic)], authMagic) {
+		return "", ErrAuthFailed
+	}
+	nonceS := challenge[len(authMagic):]
+
+	nonceC := make([]byte, authNonceLen)
+	if _, err := rand.Read(nonceC); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 0, authNonceLen+1+len(ss.name)+sha256.Size)
+	buf = append(buf, nonceC...)
+	buf = append(buf, byte(len(ss.name)))
+	buf = append(buf, ss.name...)
+	buf = append(buf, authMac(ss.secret, "client", nonceS, nonceC, []byte(ss.name))...)
+	if _, err := conn.Write(buf); err != nil {
+		return "", err
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return "", err
+	}
+	if status[0] != 1 {
+		return "", ErrAuthRejected
+	}
+
+	peer, err := authReadName(conn)
+	if err != nil {
+		return "", err
+	}
+	mac := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(conn, mac); err != nil {
+		return "", err
+	}
+	if !hmac.Equal(mac, authMac(ss.secret, "server", nonceC, nonceS, []byte(peer), []byte(ss.name))) {
+		return "", ErrAuthFailed
+	}
+	return peer, nil
+}
+
+func (ss *AuthServerPreprocessor) Process(conn net.Conn) error {
+	_, err := ss.ProcessPeer(conn)
+	return err
+}
+
+func (ss *AuthServerPreprocessor) ProcessPeer(conn net.Conn) (string, error) {
+	_ = conn.SetDeadline(time.Now().Add(authTimeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	nonceS := make([]byte, authNonceLen)
+	if _, err := rand.Read(nonceS); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(append(append([]byte{}, authMagic...), nonceS...)); err != nil {
+		return "", err
+	}
+
+	nonceC := make([]byte, authNonceLen)
+	if _, err := io.ReadFull(conn, nonceC); err != nil {
+		return "", err
+	}
+	peer, err := authReadName(conn)
+	if err != nil {
+		return "", err
+	}
+	mac := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(conn, mac); err != nil {
+		return "", err
+	}
+
+	if !hmac.Equal(mac, authMac(ss.secret, "client", nonceS, nonceC, []byte(peer))) {
+		_, _ = conn.Write([]byte{0})
+		return "", ErrAuthFailed
+	}
+	if len(ss.allowedPeers) > 0 && !slices.Contains(ss.allowedPeers, peer) {
+		_, _ = conn.Write([]byte{0})
+		return "", fmt.Errorf("%w: %s", ErrAuthUnknownPeer, peer)
+	}
+
+	buf := make([]byte, 0, 2+len(ss.name)+sha256.Size)
+	buf = append(buf, 1, byte(len(ss.name)))
+	buf = append(buf, ss.name...)
+	buf = append(buf, authMac(ss.secret, "server", nonceC, nonceS, []byte(ss.name), []byte(peer))...)
+	if _, err = conn.Write(buf); err != nil {
+		return "", err
+	}
+	return peer, nil
+}
+
+func authReadName(conn net.Conn) (string, error) {
+	l := make([]byte, 1)
+	if _, err := io.ReadFull(conn, l); err != nil {
+		return "", err
+	}
+	if l[0] == 0 {
+		return "", ErrAuthFailed
+	}
+
+	name := make([]byte, l[0])
+	if _, err := io.ReadFull(conn, name); err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+func authMac(secret []byte, label string, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(label))
+	for _, p := range parts {
+		// 写入长度，避免不同字段拼接产生歧义
+		h.Write([]byte{byte(len(p))})
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
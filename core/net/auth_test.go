@@ -0,0 +1,66 @@
+package net_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	net2 "github.com/mogud/snow/core/net"
+	"github.com/stretchr/testify/assert"
+)
+
+type authResult struct {
+	peer string
+	err  error
+}
+
+func runAuth(client, server net2.IPeerPreprocessor) (authResult, authResult) {
+	c, s := net.Pipe()
+	defer func() {
+		_ = c.Close()
+		_ = s.Close()
+	}()
+
+	ch := make(chan authResult, 1)
+	go func() {
+		peer, err := server.ProcessPeer(s)
+		if err != nil {
+			_ = s.Close()
+		}
+		ch <- authResult{peer, err}
+	}()
+
+	peer, err := client.ProcessPeer(c)
+	return authResult{peer, err}, <-ch
+}
+
+func TestAuth_MutualIdentity(t *testing.T) {
+	secret := []byte("cluster-secret")
+	client, _ := net2.NewAuthPreprocessors("node-a", secret, nil)
+	_, server := net2.NewAuthPreprocessors("node-b", secret, []string{"node-a"})
+
+	c, s := runAuth(client, server)
+	assert.NoError(t, c.err)
+	assert.NoError(t, s.err)
+	assert.Equal(t, "node-b", c.peer)
+	assert.Equal(t, "node-a", s.peer)
+}
+
+func TestAuth_WrongSecret(t *testing.T) {
+	client, _ := net2.NewAuthPreprocessors("node-a", []byte("wrong"), nil)
+	_, server := net2.NewAuthPreprocessors("node-b", []byte("cluster-secret"), nil)
+
+	c, s := runAuth(client, server)
+	assert.ErrorIs(t, c.err, net2.ErrAuthRejected)
+	assert.ErrorIs(t, s.err, net2.ErrAuthFailed)
+}
+
+func TestAuth_UnknownPeer(t *testing.T) {
+	secret := []byte("cluster-secret")
+	client, _ := net2.NewAuthPreprocessors("node-x", secret, nil)
+	_, server := net2.NewAuthPreprocessors("node-b", secret, []string{"node-a"})
+
+	c, s := runAuth(client, server)
+	assert.ErrorIs(t, c.err, net2.ErrAuthRejected)
+	assert.True(t, errors.Is(s.err, net2.ErrAuthUnknownPeer))
+}
@@ -1,9 +1,86 @@
 package net
 
 import (
+	"errors"
 	"net"
 )
 
+// ErrProcessConnRequired 预处理器会替换连接（如建立加密通道），须通过 ProcessConn 或 Preprocess 使用，Process 无法返回替换后的连接
+var ErrProcessConnRequired = errors.New("preprocessor replaces the connection, use ProcessConn")
+
 type IPreprocessor interface {
 	Process(conn net.Conn) error
 }
+
+// IPeerPreprocessor 可认证对端身份的预处理器
+type IPeerPreprocessor interface {
+	IPreprocessor
+
+	// ProcessPeer 处理新连接，成功时返回通过认证的对端名称
+	ProcessPeer(conn net.Conn) (string, error)
+}
+
+// IConnPreprocessor 可替换连接的预处理器，例如在连接上建立加密通道
+type IConnPreprocessor interface {
+	IPreprocessor
+
+	// ProcessConn 处理新连接，返回后续用于收发的连接及对端名称，未认证对端时名称为空
+	ProcessConn(conn net.Conn) (net.Conn, string, error)
+}
+
+// Preprocess 使用预处理器处理新连接，返回后续用于收发的连接及对端名称
+func Preprocess(p IPreprocessor, conn net.Conn) (net.Conn, string, error) {
+	switch pp := p.(type) {
+	case IConnPreprocessor:
+		return pp.ProcessConn(conn)
+	case IPeerPreprocessor:
+		peer, err := pp.ProcessPeer(conn)
+		return conn, peer, err
+	default:
+		return conn, "", p.Process(conn)
+	}
+}
+
+var _ IConnPreprocessor = PreprocessorChain(nil)
+
+// PreprocessorChain 按顺序执行的预处理器，后者在前者返回的连接上执行，对端名称取最后一个非空的名称
+type PreprocessorChain []IPreprocessor
+
+// Process 仅当链中不含替换连接的预处理器时可用，否则返回 ErrProcessConnRequired 且不读写连接
+func (ss PreprocessorChain) Process(conn net.Conn) error {
+	if ss.replacesConn() {
+		return ErrProcessConnRequired
+	}
+	_, _, err := ss.ProcessConn(conn)
+	return err
+}
+
+func (ss PreprocessorChain) replacesConn() bool {
+	for _, p := range ss {
+		switch pp := p.(type) {
+		case PreprocessorChain:
+			if pp.replacesConn() {
+				return true
+			}
+		case IConnPreprocessor:
+			return true
+		}
+	}
+	return false
+}
+
+func (ss PreprocessorChain) ProcessConn(conn net.Conn) (net.Conn, string, error) {
+	var peer string
+	for _, p := range ss {
+		c, name, err := Preprocess(p, conn)
+		if err != nil {
+			return nil, "", err
+		}
+
+		conn = c
+		if len(name) > 0 {
+			peer = name
+		}
+	}
+	return conn, peer, nil
+}
@@ -11,7 +11,7 @@ type ping struct {
 	node.Service
 
 	closeChan chan struct{}
-	pongProxy node.IProxy
+	pongProxy PongProxy
 }
 
 func (ss *ping) ConstructPing() {
@@ -22,7 +22,7 @@ func (ss *ping) Start(_ any) {
 	ss.Infof("ping start")
 
 	ss.closeChan = make(chan struct{})
-	ss.pongProxy = ss.CreateProxy("Pong")
+	ss.pongProxy = NewPongProxy(ss.CreateProxy("Pong"))
 
 	go func() {
 		ticker := time.NewTicker(3 * time.Second)
@@ -32,7 +32,7 @@ func (ss *ping) Start(_ any) {
 			case <-ticker.C:
 				ss.Fork("rpc", func() {
 					ss.Infof("=====================")
-					ss.pongProxy.Call("Hello", "ping").
+					ss.pongProxy.Hello("ping").
 						Then(func(ret string) {
 							ss.Infof("received: %s", ret)
 						}).Done()
@@ -1,5 +1,7 @@
 package main
 
+//go:generate go run github.com/mogud/snow/routines/node/cmd/snowgen -type pong
+
 import (
 	"sync"
 
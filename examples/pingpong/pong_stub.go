@@ -0,0 +1,32 @@
+// Code generated by "snowgen -type pong"; DO NOT EDIT.
+
+package main
+
+import (
+	"github.com/mogud/snow/routines/node"
+)
+
+// PongProxy pong 的类型化代理，方法对应 pong 的 Rpc 方法
+type PongProxy struct {
+	node.IProxy
+}
+
+// NewPongProxy 将 proxy 包装为 PongProxy
+func NewPongProxy(proxy node.IProxy) PongProxy {
+	return PongProxy{IProxy: proxy}
+}
+
+// Hello 调用 pong.RpcHello
+func (ss PongProxy) Hello(msg string) node.Promise1[string] {
+	return node.Promise1[string]{IPromise: ss.IProxy.Call("Hello", msg)}
+}
+
+// Reload 调用 pong.RpcReload
+func (ss PongProxy) Reload() node.Promise0 {
+	return node.Promise0{IPromise: ss.IProxy.Call("Reload")}
+}
+
+// Status 调用 pong.RpcStatus
+func (ss PongProxy) Status() node.Promise1[string] {
+	return node.Promise1[string]{IPromise: ss.IProxy.Call("Status")}
+}
@@ -1,9 +1,9 @@
 package node
 
 import (
-	"fmt"
 	"net"
 	"strconv"
+	"sync"
 )
 
 var _ = (INodeAddr)((*Addr)(nil))
@@ -14,41 +14,109 @@ var (
 	AddrInvalid = Addr(-2)
 )
 
+// addrHostFlag 标记高 32 位为主机表索引而非 IPv4 地址，端口仅占用低 16 位，该位在 IPv4 地址中恒为 0
+const addrHostFlag = Addr(1) << 16
+
+// addrHosts IPv6 地址及主机名的驻留表，相同主机始终得到相同的索引，保证 Addr 可直接比较及作为 map 键
+var addrHosts = struct {
+	sync.RWMutex
+	index map[string]int64
+	hosts []string
+}{
+	index: map[string]int64{},
+	hosts: []string{""}, // 索引从 1 开始
+}
+
+// Addr 节点地址，IPv4 地址编码为 ip<<32 | port；IPv6 地址与主机名编码为 index<<32 | addrHostFlag | port，
+// 其中主机名在每次连接时重新解析
 type Addr int64
 
+func (ss Addr) isHost() bool {
+	return ss > 0 && ss&addrHostFlag != 0
+}
+
+func (ss Addr) ipv4() net.IP {
+	return net.IP([]byte{byte(ss >> 56), byte(ss >> 48), byte(ss >> 40), byte(ss >> 32)})
+}
+
+func (ss Addr) host() string {
+	addrHosts.RLock()
+	defer addrHosts.RUnlock()
+
+	if idx := int(ss >> 32); idx < len(addrHosts.hosts) {
+		return addrHosts.hosts[idx]
+	}
+	return ""
+}
+
 func (ss Addr) IsLocalhost() bool {
-	return ss == 0 || net.IP([]byte{byte(ss >> 56), byte(ss >> 48), byte(ss >> 40), byte(ss >> 32)}).IsLoopback()
+	if ss == 0 {
+		return true
+	}
+	if !ss.isHost() {
+		return ss.ipv4().IsLoopback()
+	}
+
+	host := ss.host()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return host == "localhost"
 }
 
+// GetIPString 获取 IP 字符串，以主机名创建的地址返回主机名
 func (ss Addr) GetIPString() string {
-	return net.IP([]byte{byte(ss >> 56), byte(ss >> 48), byte(ss >> 40), byte(ss >> 32)}).String()
+	if ss.isHost() {
+		return ss.host()
+	}
+	return ss.ipv4().String()
 }
 
 func (ss Addr) GetPort() int {
 	return int(ss & 0xffff)
 }
 
+// String 获取可用于拨号的地址字符串，IPv6 地址带有方括号
 func (ss Addr) String() string {
-	return (&net.TCPAddr{
-		IP:   []byte{byte(ss >> 56), byte(ss >> 48), byte(ss >> 40), byte(ss >> 32)},
-		Port: int(ss & 0xffff),
-	}).String()
+	return net.JoinHostPort(ss.GetIPString(), strconv.Itoa(ss.GetPort()))
 }
 
+// NewNodeAddr 创建节点地址，host 可以是 IPv4、IPv6 地址或主机名，为空时代表本机
 func NewNodeAddr(host string, port int) (Addr, error) {
-	ipaddr, err := net.ResolveTCPAddr("tcp4", host+":"+strconv.Itoa(port))
-	if err != nil {
-		return 0, err
+	if port < 0 || port > 0xffff {
+		return 0, &net.AddrError{Err: "invalid port", Addr: strconv.Itoa(port)}
 	}
-
-	if len(ipaddr.IP) == 0 {
+	if len(host) == 0 {
 		return Addr(port), nil
 	}
 
-	v4 := ipaddr.IP.To4()
-	if v4 == nil {
-		return 0, fmt.Errorf("IPv6(%v) is not supported", host+":"+strconv.Itoa(port))
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// 主机名需要能够解析，但保留主机名以便重连时重新解析
+		if _, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(host, strconv.Itoa(port))); err != nil {
+			return 0, err
+		}
+		return internAddrHost(host) | Addr(port), nil
 	}
 
-	return Addr(v4[0])<<56 | Addr(v4[1])<<48 | Addr(v4[2])<<40 | Addr(v4[3])<<32 | Addr(port), nil
+	if v4 := ip.To4(); v4 != nil {
+		return Addr(v4[0])<<56 | Addr(v4[1])<<48 | Addr(v4[2])<<40 | Addr(v4[3])<<32 | Addr(port), nil
+	}
+	return internAddrHost(ip.String()) | Addr(port), nil
+}
+
+func internAddrHost(host string) Addr {
+	addrHosts.RLock()
+	idx, ok := addrHosts.index[host]
+	addrHosts.RUnlock()
+	if !ok {
+		addrHosts.Lock()
+		if idx, ok = addrHosts.index[host]; !ok {
+			idx = int64(len(addrHosts.hosts))
+			addrHosts.hosts = append(addrHosts.hosts, host)
+			addrHosts.index[host] = idx
+		}
+		addrHosts.Unlock()
+	}
+	return Addr(idx)<<32 | addrHostFlag
 }
@@ -0,0 +1,68 @@
+package node
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeAddrIPv4KeepsEncoding(t *testing.T) {
+	a, err := NewNodeAddr("10.1.2.3", 8000)
+	require.NoError(t, err)
+	require.Equal(t, Addr(10)<<56|Addr(1)<<48|Addr(2)<<40|Addr(3)<<32|8000, a)
+	require.Equal(t, "10.1.2.3:8000", a.String())
+	require.False(t, a.IsLocalhost())
+
+	a, err = NewNodeAddr("", 8000)
+	require.NoError(t, err)
+	require.Equal(t, Addr(8000), a)
+
+	require.True(t, AddrLocal.IsLocalhost())
+	require.False(t, AddrRemote.IsLocalhost())
+	require.False(t, AddrInvalid.IsLocalhost())
+}
+
+func TestNodeAddrIPv6AndHostname(t *testing.T) {
+	a, err := NewNodeAddr("::1", 8000)
+	require.NoError(t, err)
+	require.Equal(t, "[::1]:8000", a.String())
+	require.Equal(t, "::1", a.GetIPString())
+	require.Equal(t, 8000, a.GetPort())
+	require.True(t, a.IsLocalhost())
+
+	// 相同主机得到相同地址，可作为 map 键
+	b, err := NewNodeAddr("0:0:0:0:0:0:0:1", 8000)
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	c, err := NewNodeAddr("2001:db8::1", 8001)
+	require.NoError(t, err)
+	require.NotEqual(t, a, c)
+	require.Equal(t, "[2001:db8::1]:8001", c.String())
+	require.False(t, c.IsLocalhost())
+
+	h, err := NewNodeAddr("localhost", 8000)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:8000", h.String())
+	require.True(t, h.IsLocalhost())
+	require.NotEqual(t, a, h)
+
+	_, err = NewNodeAddr("::1", 70000)
+	require.Error(t, err)
+}
+
+func TestNodeAddrIPv6Dial(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	a, err := NewNodeAddr("::1", l.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", a.String())
+	require.NoError(t, err)
+	_ = conn.Close()
+}
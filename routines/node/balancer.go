@@ -0,0 +1,224 @@
+package node
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+)
+
+// BalanceCandidate 负载均衡的候选节点
+type BalanceCandidate struct {
+	Addr        INodeAddr
+	Outstanding int // 经该代理发往此节点尚未完成的调用数
+}
+
+// IBalancer 负载均衡策略，可在多个代理间共享，需线程安全
+type IBalancer interface {
+	// Pick 从非空的候选节点中选择一个，返回其下标；key 为 CallWithKey 指定的键，Call 调用时为空
+	Pick(candidates []BalanceCandidate, key string) int
+}
+
+var (
+	_ IBalancer = (*roundRobinBalancer)(nil)
+	_ IBalancer = (*randomBalancer)(nil)
+	_ IBalancer = (*leastOutstandingBalancer)(nil)
+	_ IBalancer = (*consistentHashBalancer)(nil)
+)
+
+// NewRoundRobinBalancer 轮询
+func NewRoundRobinBalancer() IBalancer {
+	return &roundRobinBalancer{}
+}
+
+// NewRandomBalancer 随机
+func NewRandomBalancer() IBalancer {
+	return &randomBalancer{}
+}
+
+// NewLeastOutstandingBalancer 选择未完成调用数最少的节点，数量相同时随机
+func NewLeastOutstandingBalancer() IBalancer {
+	return &leastOutstandingBalancer{}
+}
+
+// NewConsistentHashBalancer 一致性哈希，相同的 key 总是落在同一节点，节点增减时仅影响该节点上的 key
+func NewConsistentHashBalancer() IBalancer {
+	return &consistentHashBalancer{}
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (ss *roundRobinBalancer) Pick(candidates []BalanceCandidate, _ string) int {
+	return int((ss.next.Add(1) - 1) % uint64(len(candidates)))
+}
+
+type randomBalancer struct{}
+
+func (ss *randomBalancer) Pick(candidates []BalanceCandidate, _ string) int {
+	return rand.IntN(len(candidates))
+}
+
+type leastOutstandingBalancer struct{}
+
+func (ss *leastOutstandingBalancer) Pick(candidates []BalanceCandidate, _ string) int {
+	// 从随机位置开始查找，避免数量相同时总是选中第一个
+	start := rand.IntN(len(candidates))
+	best := start
+	for i := 1; i < len(candidates); i++ {
+		idx := (start + i) % len(candidates)
+		if candidates[idx].Outstanding < candidates[best].Outstanding {
+			best = idx
+		}
+	}
+	return best
+}
+
+// consistentHashBalancer 使用最高随机权重（Rendezvous）哈希，无需维护哈希环
+type consistentHashBalancer struct{}
+
+func (ss *consistentHashBalancer) Pick(candidates []BalanceCandidate, key string) int {
+	best := 0
+	var bestWeight uint64
+	for i, c := range candidates {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(c.Addr.String()))
+		if w := h.Sum64(); i == 0 || w > bestWeight {
+			best, bestWeight = i, w
+		}
+	}
+	return best
+}
+
+var _ IBalancedProxy = (*balancedProxy)(nil)
+
+// balancedProxy 在所有提供服务的节点间负载均衡的代理，每个节点使用一个子代理发送，非线程安全
+type balancedProxy struct {
+	srv      *Service
+	name     string
+	sAddr    int32
+	balancer IBalancer
+
+	proxies     map[Addr]*serviceProxy
+	outstanding map[Addr]int
+	lastAddr    Addr
+}
+
+// balancedCall 携带哈希键的单次调用
+type balancedCall struct {
+	*balancedProxy
+	key string
+}
+
+func (ss *balancedCall) doCall(p *promise) {
+	ss.balancedProxy.doCallWithKey(p, ss.key)
+}
+
+func (ss *balancedProxy) Call(fName string, args ...any) IPromise {
+	return newPromise(ss, fName, args)
+}
+
+func (ss *balancedProxy) CallWithKey(key string, fName string, args ...any) IPromise {
+	return newPromise(&balancedCall{balancedProxy: ss, key: key}, fName, args)
+}
+
+// GetNodeAddr 获取最近一次调用选中的节点地址
+func (ss *balancedProxy) GetNodeAddr() INodeAddr {
+	return ss.lastAddr
+}
+
+func (ss *balancedProxy) Avail() bool {
+	return ss.sAddr != 0
+}
+
+func (ss *balancedProxy) getService() *Service {
+	return ss.srv
+}
+
+func (ss *balancedProxy) doCall(p *promise) {
+	ss.doCallWithKey(p, "")
+}
+
+func (ss *balancedProxy) doCallWithKey(p *promise, key string) {
+	addrs := ss.candidates()
+	if len(addrs) == 0 {
+		// 交由子代理按服务不存在处理
+		addrs = []Addr{AddrInvalid}
+	}
+
+	candidates := make([]BalanceCandidate, len(addrs))
+	for i, addr := range addrs {
+		candidates[i] = BalanceCandidate{Addr: addr, Outstanding: ss.outstanding[addr]}
+	}
+	nAddr := addrs[ss.balancer.Pick(candidates, key)]
+	ss.lastAddr = nAddr
+
+	sub := ss.proxies[nAddr]
+	if sub == nil {
+		sub = &serviceProxy{
+			srv:   ss.srv,
+			nAddr: nAddr,
+			sAddr: ss.sAddr,
+		}
+		ss.proxies[nAddr] = sub
+	}
+
+	// finalCb 总是在服务主线程调用，无论成功、失败或超时
+	ss.outstanding[nAddr]++
+	finalCb := p.finalCb
+	p.finalCb = func() {
+		if ss.outstanding[nAddr]--; ss.outstanding[nAddr] <= 0 {
+			delete(ss.outstanding, nAddr)
+		}
+		if finalCb != nil {
+			finalCb()
+		}
+	}
+	sub.doCall(p)
+}
+
+// candidates 获取提供服务的全部节点，跳过连接不可用的节点；全部不可用时返回全部节点，由重连逻辑缓存或失败
+func (ss *balancedProxy) candidates() []Addr {
+	var all []Addr
+	if Config.CurNodeMap[ss.name] {
+		all = append(all, AddrLocal)
+	}
+	for _, ni := range Config.Nodes {
+		if ni.Name != Config.CurNodeName && len(ni.Host) > 0 && ni.Port > 0 && slices.Contains(ni.Services, ss.name) && !slices.Contains(all, ni.NodeAddr) {
+			all = append(all, ni.NodeAddr)
+		}
+	}
+	if d := ss.srv.node.discovery; d != nil {
+		for _, addr := range d.lookupAll(ss.name) {
+			if !slices.Contains(all, addr) {
+				all = append(all, addr)
+			}
+		}
+	}
+
+	avail := make([]Addr, 0, len(all))
+	for _, addr := range all {
+		if nodeRemoteAvailable(addr) {
+			avail = append(avail, addr)
+		}
+	}
+	if len(avail) == 0 {
+		return all
+	}
+	return avail
+}
+
+// nodeRemoteAvailable 节点连接是否可用，尚未建立连接的节点视为可用
+func nodeRemoteAvailable(nAddr Addr) bool {
+	if nAddr == AddrLocal {
+		return true
+	}
+
+	gNode.Lock()
+	h := gNode.handle[nAddr]
+	gNode.Unlock()
+	return h == nil || (!h.closed() && h.connected.Load())
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalancerStrategies(t *testing.T) {
+	candidates := make([]BalanceCandidate, 3)
+	for i := range candidates {
+		addr, _ := NewNodeAddr("127.0.0.1", 1000+i)
+		candidates[i] = BalanceCandidate{Addr: addr}
+	}
+
+	rr := NewRoundRobinBalancer()
+	picked := make([]int, 0, 6)
+	for range 6 {
+		picked = append(picked, rr.Pick(candidates, ""))
+	}
+	require.Equal(t, []int{0, 1, 2, 0, 1, 2}, picked)
+
+	candidates[0].Outstanding, candidates[1].Outstanding, candidates[2].Outstanding = 3, 1, 2
+	lo := NewLeastOutstandingBalancer()
+	for range 10 {
+		require.Equal(t, 1, lo.Pick(candidates, ""))
+	}
+
+	// 相同 key 总是落在同一节点，移除其他节点不影响该 key
+	ch := NewConsistentHashBalancer()
+	moved := 0
+	for i := range 100 {
+		key := fmt.Sprint("user-", i)
+		idx := ch.Pick(candidates, key)
+		require.Equal(t, idx, ch.Pick(candidates, key))
+
+		remain := append([]BalanceCandidate(nil), candidates[:2]...)
+		if idx == 2 {
+			moved++
+			continue
+		}
+		require.Equal(t, idx, ch.Pick(remain, key))
+	}
+	require.Greater(t, moved, 0)
+	require.Less(t, moved, 100)
+}
+
+func TestBalancedProxySkipsDisconnectedNodes(t *testing.T) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+
+	r := NewMemoryRegistry(0)
+	ctx := context.Background()
+	_, err := r.Announce(ctx, &NodeEntry{Name: "a", Order: 1, Host: "127.0.0.1", Port: 2, Services: []string{"Pong"}})
+	require.NoError(t, err)
+	_, err = r.Announce(ctx, &NodeEntry{Name: "b", Order: 2, Host: "127.0.0.1", Port: 3, Services: []string{"Pong"}})
+	require.NoError(t, err)
+	d := newDiscovery(r, &NodeEntry{Name: "self", Host: "127.0.0.1", Port: 1}, 0)
+	d.announce(ctx)
+
+	a, _ := NewNodeAddr("127.0.0.1", 2)
+	b, _ := NewNodeAddr("127.0.0.1", 3)
+	testNode := &Node{
+		services:  make(map[int32]*Service),
+		handle:    make(map[Addr]*remoteHandle),
+		discovery: d,
+	}
+	ha := newRemoteHandle(testNode, a, nil)
+	hb := newRemoteHandle(testNode, b, nil)
+	hb.connected.Store(true)
+	testNode.handle[a] = ha
+	testNode.handle[b] = hb
+	gNode = testNode
+
+	proxy := &balancedProxy{
+		srv:         &Service{node: testNode, sAddr: 1},
+		name:        "Pong",
+		sAddr:       -1,
+		balancer:    NewRoundRobinBalancer(),
+		proxies:     make(map[Addr]*serviceProxy),
+		outstanding: make(map[Addr]int),
+	}
+
+	// a 未连接时全部发往 b
+	for range 4 {
+		proxy.Call("Ping").Then(func() {}).Done()
+	}
+	require.Empty(t, ha.wBuffer)
+	require.Len(t, hb.wBuffer, 4)
+	require.Equal(t, 4, proxy.outstanding[b])
+	require.Equal(t, b, proxy.GetNodeAddr())
+
+	// a 连接后参与轮询
+	ha.connected.Store(true)
+	for range 4 {
+		proxy.Call("Ping").Then(func() {}).Done()
+	}
+	require.Len(t, ha.wBuffer, 2)
+	require.Len(t, hb.wBuffer, 6)
+
+	// 全部不可用时仍发往某个节点，由重连缓存
+	ha.connected.Store(false)
+	hb.connected.Store(false)
+	proxy.Call("Ping").Then(func() {}).Done()
+	require.Equal(t, 9, len(ha.wBuffer)+len(hb.wBuffer))
+}
@@ -0,0 +1,242 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrCircuitOpen = fmt.Errorf("circuit breaker open")
+
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerMinRequests         = 10
+	defaultBreakerWindow              = 10 * time.Second
+	defaultBreakerOpenInterval        = 5 * time.Second
+	defaultBreakerHalfOpenProbes      = 1
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 熔断，调用立即以 ErrCircuitOpen 失败
+	BreakerHalfOpen                     // 半开，仅放行有限的探测请求
+)
+
+func (ss BreakerState) String() string {
+	switch ss {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(ss))
+}
+
+// CircuitBreakerOption 熔断器配置，零值字段使用默认值
+type CircuitBreakerOption struct {
+	Name                string           // 用于日志及指标，默认为代理的节点地址
+	ConsecutiveFailures int              // 连续失败次数达到该值时熔断，默认 5，小于 0 时不按连续失败熔断
+	FailureRatio        float64          // 统计窗口内失败比例达到该值时熔断，不大于 0 时不按比例熔断
+	MinRequests         int              // 按比例熔断时窗口内的最少调用数，默认 10
+	Window              time.Duration    // 失败比例统计窗口，默认 10 秒
+	OpenInterval        time.Duration    // 熔断持续时长，之后进入半开状态，默认 5 秒
+	HalfOpenProbes      int              // 半开状态下放行的探测请求数，全部成功后恢复，任一失败重新熔断，默认 1
+	IsFailure           func(error) bool // 判断错误是否计为失败，为空时全部错误计为失败
+}
+
+var _ iProxy = (*breakerProxy)(nil)
+
+// breakerProxy 为代理增加熔断，非线程安全
+//
+// 仅请求的结果参与统计；投递只统计本地失败，且在半开状态下被拒绝，以免占用探测名额
+type breakerProxy struct {
+	srv   *Service
+	inner iProxy
+	opt   CircuitBreakerOption
+
+	state       BreakerState
+	consecutive int
+	windowStart time.Time
+	total       int
+	failed      int
+	openUntil   time.Time
+	probes      int // 半开状态下已放行的探测数
+	probeOk     int // 半开状态下已成功的探测数
+	generation  int // 每次状态变化递增，丢弃旧状态下发出的调用结果
+}
+
+// CreateCircuitBreakerProxy 为代理增加熔断器，opt 为空时使用默认配置，非线程安全
+func (ss *Service) CreateCircuitBreakerProxy(proxy IProxy, opt *CircuitBreakerOption) IProxy {
+	inner, ok := proxy.(iProxy)
+	if !ok || !proxy.Avail() {
+		return proxy
+	}
+
+	b := &breakerProxy{srv: ss, inner: inner}
+	if opt != nil {
+		b.opt = *opt
+	}
+	if len(b.opt.Name) == 0 {
+		b.opt.Name = proxy.GetNodeAddr().String()
+	}
+	if b.opt.ConsecutiveFailures == 0 {
+		b.opt.ConsecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if b.opt.MinRequests <= 0 {
+		b.opt.MinRequests = defaultBreakerMinRequests
+	}
+	if b.opt.Window <= 0 {
+		b.opt.Window = defaultBreakerWindow
+	}
+	if b.opt.OpenInterval <= 0 {
+		b.opt.OpenInterval = defaultBreakerOpenInterval
+	}
+	if b.opt.HalfOpenProbes <= 0 {
+		b.opt.HalfOpenProbes = defaultBreakerHalfOpenProbes
+	}
+	return b
+}
+
+func (ss *breakerProxy) Call(fName string, args ...any) IPromise {
+	return newPromise(ss, fName, args)
+}
+
+func (ss *breakerProxy) GetNodeAddr() INodeAddr {
+	return ss.inner.GetNodeAddr()
+}
+
+func (ss *breakerProxy) Avail() bool {
+	return ss.inner.Avail()
+}
+
+func (ss *breakerProxy) getService() *Service {
+	return ss.srv
+}
+
+func (ss *breakerProxy) doCall(p *promise) {
+	now := ss.srv.GetTime()
+	isRequest := p.successCb != nil
+
+	switch ss.state {
+	case BreakerOpen:
+		if now.Before(ss.openUntil) {
+			ss.reject(p)
+			return
+		}
+		ss.setState(BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if !isRequest || ss.probes >= ss.opt.HalfOpenProbes {
+			ss.reject(p)
+			return
+		}
+		ss.probes++
+	}
+
+	gen := ss.generation
+	failed := false
+	errCb := p.errCb
+	p.errCb = func(err error) {
+		// 调用方主动取消及响应与回调不匹配不计入失败
+		if err != ErrRequestCanceled && !errors.Is(err, ErrResponseInvalid) && (ss.opt.IsFailure == nil || ss.opt.IsFailure(err)) {
+			failed = true
+		}
+		if errCb != nil {
+			errCb(err)
+		} else {
+			ss.srv.Errorf("rpc(%s) uncatched error: %+v", p.fName, err)
+		}
+	}
+	finalCb := p.finalCb
+	p.finalCb = func() {
+		if gen == ss.generation && (isRequest || failed) {
+			ss.onResult(failed)
+		}
+		if finalCb != nil {
+			finalCb()
+		}
+	}
+	ss.inner.doCall(p)
+}
+
+func (ss *breakerProxy) reject(p *promise) {
+	if mc := ss.srv.node.regOpt.MetricCollector; mc != nil {
+		mc.Counter("[CircuitBreaker] rejected "+ss.opt.Name, 1)
+	}
+
+	srv := ss.srv
+	if p.errCb != nil {
+		srv.Fork("breaker.err.cb", func() {
+			srv.withTrace(p.trace, func() {
+				p.errCb(ErrCircuitOpen)
+			})
+		})
+	}
+	srv.Fork("breaker.err.finalCb", func() {
+		if p.finalCb != nil {
+			p.finalCb()
+		}
+		p.clear()
+	})
+}
+
+// onResult 记录调用结果并按需切换状态
+func (ss *breakerProxy) onResult(failed bool) {
+	now := ss.srv.GetTime()
+
+	if ss.state == BreakerHalfOpen {
+		if failed {
+			ss.setState(BreakerOpen, now)
+		} else if ss.probeOk++; ss.probeOk >= ss.opt.HalfOpenProbes {
+			ss.setState(BreakerClosed, now)
+		}
+		return
+	}
+
+	if now.Sub(ss.windowStart) >= ss.opt.Window {
+		ss.windowStart = now
+		ss.total, ss.failed = 0, 0
+	}
+	ss.total++
+	if !failed {
+		ss.consecutive = 0
+		return
+	}
+	ss.failed++
+	ss.consecutive++
+
+	if ss.opt.ConsecutiveFailures > 0 && ss.consecutive >= ss.opt.ConsecutiveFailures {
+		ss.setState(BreakerOpen, now)
+	} else if ss.opt.FailureRatio > 0 && ss.total >= ss.opt.MinRequests && float64(ss.failed) >= ss.opt.FailureRatio*float64(ss.total) {
+		ss.setState(BreakerOpen, now)
+	}
+}
+
+func (ss *breakerProxy) setState(state BreakerState, now time.Time) {
+	if state == BreakerOpen {
+		ss.openUntil = now.Add(ss.opt.OpenInterval)
+	}
+	ss.generation++
+	ss.consecutive = 0
+	ss.windowStart = now
+	ss.total, ss.failed = 0, 0
+	ss.probes, ss.probeOk = 0, 0
+
+	if ss.state == state {
+		return
+	}
+	ss.srv.Warnf("circuit breaker %s: %v -> %v", ss.opt.Name, ss.state, state)
+	ss.state = state
+
+	if mc := ss.srv.node.regOpt.MetricCollector; mc != nil {
+		mc.Gauge("[CircuitBreaker] state "+ss.opt.Name, int64(state))
+		if state == BreakerOpen {
+			mc.Counter("[CircuitBreaker] opened "+ss.opt.Name, 1)
+		}
+	}
+}
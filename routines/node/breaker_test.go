@@ -0,0 +1,133 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{}
+
+func (testLogger) Tracef(string, ...any) {}
+func (testLogger) Debugf(string, ...any) {}
+func (testLogger) Infof(string, ...any)  {}
+func (testLogger) Warnf(string, ...any)  {}
+func (testLogger) Errorf(string, ...any) {}
+func (testLogger) Fatalf(string, ...any) {}
+
+// testProxy 记录调用，由测试决定结果
+type testProxy struct {
+	srv   *Service
+	calls []*promise
+}
+
+func (ss *testProxy) Call(fName string, args ...any) IPromise { return newPromise(ss, fName, args) }
+func (ss *testProxy) GetNodeAddr() INodeAddr                  { return Addr(101) }
+func (ss *testProxy) Avail() bool                             { return true }
+func (ss *testProxy) getService() *Service                    { return ss.srv }
+func (ss *testProxy) doCall(p *promise)                       { ss.calls = append(ss.calls, p) }
+
+func (ss *testProxy) resolve(i int, err error) {
+	p := ss.calls[i]
+	if err != nil && p.errCb != nil {
+		p.errCb(err)
+	}
+	if p.finalCb != nil {
+		p.finalCb()
+	}
+}
+
+func newBreakerTestService() (*Service, *testMetricCollector) {
+	mc := &testMetricCollector{gauges: map[string]int64{}, counters: map[string]uint64{}}
+	return &Service{
+		node:   &Node{regOpt: &RegisterOption{MetricCollector: mc}},
+		logger: testLogger{},
+		nowNs:  time.Now().UnixNano(),
+	}, mc
+}
+
+func runForked(srv *Service) {
+	srv.funcBufferLock.Lock()
+	fs := srv.funcBuffer
+	srv.funcBuffer = nil
+	srv.funcBufferLock.Unlock()
+	for _, f := range fs {
+		f.F()
+	}
+}
+
+func TestCircuitBreakerOpensOnConsecutiveFailures(t *testing.T) {
+	srv, mc := newBreakerTestService()
+	inner := &testProxy{}
+	proxy := srv.CreateCircuitBreakerProxy(inner, &CircuitBreakerOption{
+		Name:                "Pong",
+		ConsecutiveFailures: 3,
+		OpenInterval:        time.Second,
+	})
+	b := proxy.(*breakerProxy)
+
+	for i := range 3 {
+		proxy.Call("Ping").Then(func() {}).Catch(func(error) {}).Done()
+		inner.resolve(i, ErrRequestTimeoutLocal)
+	}
+	require.Equal(t, BreakerOpen, b.state)
+	require.Equal(t, int64(BreakerOpen), mc.gauges["[CircuitBreaker] state Pong"])
+
+	// 熔断期间立即失败，不再发往内部代理
+	var errs []error
+	finals := 0
+	proxy.Call("Ping").Then(func() {}).Catch(func(err error) { errs = append(errs, err) }).Final(func() { finals++ }).Done()
+	runForked(srv)
+	require.Len(t, inner.calls, 3)
+	require.Equal(t, []error{ErrCircuitOpen}, errs)
+	require.Equal(t, 1, finals)
+	require.Equal(t, uint64(1), mc.counters["[CircuitBreaker] rejected Pong"])
+
+	// 熔断结束后仅放行一个探测请求，投递被拒绝
+	srv.nowNs += int64(time.Second)
+	proxy.Call("Ping").Then(func() {}).Done()
+	proxy.Call("Ping").Then(func() {}).Done()
+	proxy.Call("Notify").Done()
+	require.Len(t, inner.calls, 4)
+	require.Equal(t, BreakerHalfOpen, b.state)
+
+	inner.resolve(3, nil)
+	require.Equal(t, BreakerClosed, b.state)
+	require.Equal(t, int64(BreakerClosed), mc.gauges["[CircuitBreaker] state Pong"])
+}
+
+func TestCircuitBreakerFailureRatioAndFailedProbe(t *testing.T) {
+	srv, _ := newBreakerTestService()
+	inner := &testProxy{}
+	proxy := srv.CreateCircuitBreakerProxy(inner, &CircuitBreakerOption{
+		ConsecutiveFailures: -1,
+		FailureRatio:        0.5,
+		MinRequests:         4,
+		IsFailure:           func(err error) bool { return err == ErrRequestTimeoutLocal },
+	})
+	b := proxy.(*breakerProxy)
+
+	for range 5 {
+		proxy.Call("Ping").Then(func() {}).Catch(func(error) {}).Done()
+	}
+	inner.resolve(0, ErrRequestTimeoutLocal)
+	inner.resolve(1, nil)
+	inner.resolve(2, fmt.Errorf("business error"))
+	require.Equal(t, BreakerClosed, b.state)
+	inner.resolve(3, ErrRequestTimeoutLocal)
+	require.Equal(t, BreakerOpen, b.state)
+
+	// 熔断前发出的调用结果不再影响状态
+	inner.resolve(4, nil)
+	require.Equal(t, BreakerOpen, b.state)
+
+	// 探测失败重新熔断
+	srv.nowNs += int64(defaultBreakerOpenInterval)
+	proxy.Call("Ping").Then(func() {}).Catch(func(error) {}).Done()
+	require.Equal(t, BreakerHalfOpen, b.state)
+	inner.resolve(5, ErrRequestTimeoutLocal)
+	require.Equal(t, BreakerOpen, b.state)
+	require.Equal(t, srv.GetTime().Add(defaultBreakerOpenInterval), b.openUntil)
+}
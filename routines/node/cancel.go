@@ -0,0 +1,52 @@
+package node
+
+import "slices"
+
+// trackCall 记录开始处理的请求，供调用方取消时查找
+func (ss *Service) trackCall(ctx *rpcContext) {
+	if ss.calls == nil {
+		ss.calls = make(map[callKey]*rpcContext)
+	}
+	ss.calls[ctx.key()] = ctx
+}
+
+func (ss *Service) untrackCall(ctx *rpcContext) {
+	key := ctx.key()
+	if ss.calls[key] == ctx {
+		delete(ss.calls, key)
+	}
+}
+
+// onCancel 处理调用方的取消：尚未执行的请求从邮箱中移除，正在执行或等待 EnableRpc 的请求标记为已取消，于服务主线程中调用
+func (ss *Service) onCancel(m *message) {
+	defer m.clear()
+
+	key := callKey{nAddr: m.nAddr, src: m.src, sess: m.sess}
+	if ctx := ss.calls[key]; ctx != nil {
+		ctx.cancel()
+		ss.countCanceled()
+		return
+	}
+
+	ss.msgBufferLock.Lock()
+	i := slices.IndexFunc(ss.msgBuffer, func(mm *message) bool {
+		return mm != nil && mm.sess == key.sess && mm.src == key.src && mm.nAddr == key.nAddr
+	})
+	var removed *message
+	if i >= 0 {
+		removed = ss.msgBuffer[i]
+		ss.msgBuffer = slices.Delete(ss.msgBuffer, i, i+1)
+	}
+	ss.msgBufferLock.Unlock()
+
+	if removed != nil {
+		removed.clear()
+		ss.countCanceled()
+	}
+}
+
+func (ss *Service) countCanceled() {
+	if mc := ss.node.regOpt.MetricCollector; mc != nil {
+		mc.Counter("[ServiceRpc] canceled "+ss.name, 1)
+	}
+}
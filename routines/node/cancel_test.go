@@ -0,0 +1,191 @@
+package node
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type cancelTestService struct {
+	Service
+	echoed int
+	held   []IRpcContext
+}
+
+func (ss *cancelTestService) RpcEcho(ctx IRpcContext, v int) {
+	ss.echoed++
+	ctx.Return(v)
+}
+
+func (ss *cancelTestService) RpcHold(ctx IRpcContext) {
+	ss.held = append(ss.held, ctx)
+}
+
+func newCancelTestPair(t *testing.T) (*Service, *cancelTestService, *serviceProxy, time.Time) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+	gNode = &Node{}
+
+	caller, now := newPolicyTestService()
+	caller.sAddr = 1
+
+	callee := &cancelTestService{}
+	callee.node = caller.node
+	callee.logger = testLogger{}
+	callee.tw = caller.tw
+	callee.sAddr = 2
+	callee.realSrv = callee
+	callee.methodMap = map[string]reflect.Value{
+		"Echo": reflect.ValueOf((*cancelTestService).RpcEcho),
+		"Hold": reflect.ValueOf((*cancelTestService).RpcHold),
+	}
+
+	proxy := &serviceProxy{srv: caller, sAddr: 2, sender: &callee.Service}
+	return caller, callee, proxy, now
+}
+
+func TestCancelRemovesQueuedRequest(t *testing.T) {
+	caller, callee, proxy, _ := newCancelTestPair(t)
+
+	var errs []error
+	finals := 0
+	p := proxy.Call("Echo", 1).
+		Then(func(int) { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).
+		Final(func() { finals++ })
+	p.Done()
+	p.Cancel()
+	runForked(caller)
+	require.Equal(t, []error{ErrRequestCanceled}, errs)
+	require.Equal(t, 1, finals)
+
+	// 取消先于请求处理，请求从邮箱中移除
+	callee.onTick()
+	require.Zero(t, callee.echoed)
+	require.Empty(t, callee.msgBuffer)
+
+	// 调用结束后取消无效
+	p.Cancel()
+	runForked(caller)
+	require.Len(t, errs, 1)
+}
+
+func TestCancelSignalsRunningHandler(t *testing.T) {
+	caller, callee, proxy, now := newCancelTestPair(t)
+
+	var errs []error
+	proxy.Call("Hold").Then(func() { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).
+		Timeout(100 * time.Millisecond).Done()
+	runForked(caller)
+	callee.onTick()
+	require.Len(t, callee.held, 1)
+	require.Len(t, callee.calls, 1)
+	require.False(t, callee.held[0].Canceled())
+
+	// 调用方超时后被调用方得知，之后的响应被丢弃
+	caller.tw.update(now.Add(200 * time.Millisecond))
+	runForked(caller)
+	require.Equal(t, []error{ErrRequestTimeoutLocal}, errs)
+
+	runForked(&callee.Service)
+	require.True(t, callee.held[0].Canceled())
+	require.Empty(t, callee.calls)
+
+	callee.held[0].Return()
+	runForked(caller)
+	require.Len(t, errs, 1)
+}
+
+func TestCancelClearsRemoteSession(t *testing.T) {
+	h := newRemoteHandle(&Node{}, Addr(101), nil)
+	h.sessCb.Store(int32(5), &session{cb: func(*message) {}})
+
+	require.True(t, h.send(&message{src: 1, dst: 2, sess: 5, flag: msgFlagCancel}))
+	_, ok := h.sessCb.Load(int32(5))
+	require.False(t, ok)
+
+	bs, err := h.wBuffer[0].marshal()
+	require.NoError(t, err)
+	require.Len(t, bs, messageHeaderLen)
+}
+
+func TestDeadlineExpiredRequestDropped(t *testing.T) {
+	caller, callee, proxy, _ := newCancelTestPair(t)
+
+	var errs []error
+	proxy.Call("Echo", 1).Then(func(int) { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).
+		Timeout(time.Second).Done()
+	proxy.Call("Hold").Then(func() {}).Timeout(time.Second).Done()
+
+	require.Len(t, callee.msgBuffer, 2)
+	deadline := callee.msgBuffer[1].deadline
+	require.InDelta(t, time.Now().Add(time.Second).UnixNano(), deadline, float64(100*time.Millisecond))
+
+	// 出队时已过期的请求不再执行
+	callee.msgBuffer[0].deadline = time.Now().Add(-time.Millisecond).UnixNano()
+	callee.onTick()
+	require.Zero(t, callee.echoed)
+	runForked(caller)
+	require.Equal(t, []error{ErrRequestTimeoutRemote}, errs)
+
+	require.Len(t, callee.held, 1)
+	d, ok := callee.held[0].Deadline()
+	require.True(t, ok)
+	require.Equal(t, deadline, d.UnixNano())
+}
+
+func TestDeadlineHeaderRoundTrip(t *testing.T) {
+	req := &message{src: 1, dst: 2, sess: 3, deadline: 1234567890123}
+	req.writeRequest("Echo", []any{1})
+	bs, err := req.marshal()
+	require.NoError(t, err)
+
+	m := &message{}
+	require.NoError(t, m.unmarshal(bs))
+	require.Equal(t, int64(1234567890123), m.deadline)
+}
+
+func TestHttpCallCancelAbortsRequest(t *testing.T) {
+	srv, _ := newPolicyTestService()
+
+	arrived := make(chan struct{})
+	aborted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		close(arrived)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer server.Close()
+
+	proxy := &httpProxy{srv: srv, url: server.URL, httpClient: &http.Client{}}
+	var errs []error
+	finals := 0
+	p := proxy.Call("Get").Then(func(int) { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).
+		Final(func() { finals++ })
+	p.Done()
+	<-arrived
+
+	p.Cancel()
+	require.Equal(t, []error{ErrRequestCanceled}, errs)
+	require.Equal(t, 1, finals)
+	<-aborted
+
+	// 请求中止后的错误不再回调
+	require.Eventually(t, func() bool {
+		srv.funcBufferLock.Lock()
+		defer srv.funcBufferLock.Unlock()
+		return len(srv.funcBuffer) > 0
+	}, time.Second, time.Millisecond)
+	runForked(srv)
+	require.Len(t, errs, 1)
+	require.Equal(t, 1, finals)
+}
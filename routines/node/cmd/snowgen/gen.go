@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	nodePkgPath     = "github.com/mogud/snow/routines/node"
+	returnDirective = "//snowgen:return"
+	maxResults      = 4 // node.Promise0 ~ node.Promise4
+)
+
+type generator struct {
+	ctxt     build.Context
+	fset     *token.FileSet
+	importer types.Importer
+	dir      string
+	pkg      *types.Package
+	sources  map[string]*pkgSource // 包路径: 源码，用于查找方法的声明
+
+	imports map[string]string // 包路径: 包名
+	names   map[string]string // 包名: 包路径
+}
+
+// pkgSource 解析及类型检查后的包
+type pkgSource struct {
+	pkg   *types.Package
+	info  *types.Info
+	decls map[string]*ast.FuncDecl // 接收者类型名.方法名: 声明
+}
+
+type rpcParam struct {
+	name string
+	typ  types.Type
+}
+
+type rpcMethod struct {
+	name    string // 去掉前缀后的名称，即调用时的函数名
+	target  string // 服务的方法名
+	params  []rpcParam
+	results []types.Type
+}
+
+// generate 解析 dir 中的包，为 typeNames 中的服务生成代理，outFile 为输出文件名，解析时排除以免引用旧代码
+func generate(dir string, typeNames []string, outFile string) ([]byte, error) {
+	g, err := load(dir, outFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	for _, name := range typeNames {
+		if err := g.genService(&body, strings.TrimSpace(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "// Code generated by \"snowgen -type %s\"; DO NOT EDIT.\n\n", strings.Join(typeNames, ","))
+	_, _ = fmt.Fprintf(&buf, "package %s\n\n", g.pkg.Name())
+	if len(g.imports) > 0 {
+		paths := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			paths = append(paths, path)
+		}
+		slices.Sort(paths)
+
+		buf.WriteString("import (\n")
+		for _, path := range paths {
+			if name := g.imports[path]; name != defaultPkgName(path) {
+				_, _ = fmt.Fprintf(&buf, "\t%s %q\n", name, path)
+			} else {
+				_, _ = fmt.Fprintf(&buf, "\t%q\n", path)
+			}
+		}
+		buf.WriteString(")\n\n")
+	}
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+func load(dir, outFile string) (*generator, error) {
+	ctxt := build.Default
+	// 仅需方法签名，不处理 cgo
+	ctxt.CgoEnabled = false
+
+	fset := token.NewFileSet()
+	g := &generator{
+		ctxt:     ctxt,
+		fset:     fset,
+		importer: newImporter(fset, dir),
+		dir:      dir,
+		sources:  make(map[string]*pkgSource),
+		imports:  make(map[string]string),
+		names:    make(map[string]string),
+	}
+
+	src, err := g.loadDir(dir, outFile)
+	if err != nil {
+		return nil, err
+	}
+	g.pkg = src.pkg
+	g.sources[src.pkg.Path()] = src
+	return g, nil
+}
+
+// newImporter 优先使用 go list 编译出的依赖包导出数据，失败时从源码检查依赖，后者较慢
+func newImporter(fset *token.FileSet, dir string) types.Importer {
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}\t{{.Export}}", ".")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return importer.ForCompiler(fset, "source", nil)
+	}
+
+	exports := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, file, ok := strings.Cut(line, "\t"); ok && len(file) > 0 {
+			exports[path] = file
+		}
+	}
+	return importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		file, ok := exports[path]
+		if !ok {
+			return nil, fmt.Errorf("export data of %s not found", path)
+		}
+		return os.Open(file)
+	})
+}
+
+// loadDir 解析并检查 dir 中的包，skip 为需排除的文件名
+func (ss *generator) loadDir(dir, skip string) (*pkgSource, error) {
+	bp, err := ss.ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(ss.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no go files found in %s", dir)
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer: ss.importer,
+		// 引用了尚未生成的代码时会有错误，不影响方法签名的解析
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, ss.fset, files, info)
+
+	src := &pkgSource{pkg: pkg, info: info, decls: make(map[string]*ast.FuncDecl)}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv != nil {
+				src.decls[recvTypeName(fd.Recv.List[0].Type)+"."+fd.Name.Name] = fd
+			}
+		}
+	}
+	return src, nil
+}
+
+// findDecl 查找方法的声明，内嵌的其他包中的类型的方法从该包的源码中查找
+func (ss *generator) findDecl(fn *types.Func) (*pkgSource, *ast.FuncDecl) {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil || fn.Pkg() == nil {
+		return nil, nil
+	}
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return nil, nil
+	}
+
+	path := fn.Pkg().Path()
+	src := ss.sources[path]
+	if src == nil {
+		bp, err := ss.ctxt.Import(path, ss.dir, build.FindOnly)
+		if err != nil {
+			return nil, nil
+		}
+		if src, err = ss.loadDir(bp.Dir, ""); err != nil {
+			return nil, nil
+		}
+		ss.sources[path] = src
+	}
+	return src, src.decls[named.Obj().Name()+"."+fn.Name()]
+}
+
+func recvTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func (ss *generator) genService(buf *bytes.Buffer, typeName string) error {
+	tn, ok := ss.pkg.Scope().Lookup(typeName).(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("type %s not found in package %s", typeName, ss.pkg.Name())
+	}
+
+	var rpcs, httpRpcs []*rpcMethod
+	mset := types.NewMethodSet(types.NewPointer(tn.Type()))
+	for i := range mset.Len() {
+		fn, ok := mset.At(i).Obj().(*types.Func)
+		if !ok {
+			continue
+		}
+
+		// 与 Node.Construct 的约定一致
+		var name string
+		var isHttp bool
+		if strings.HasPrefix(fn.Name(), "HttpRpc") {
+			name, isHttp = strings.TrimPrefix(fn.Name(), "HttpRpc"), true
+		} else if strings.HasPrefix(fn.Name(), "Rpc") {
+			name = strings.TrimPrefix(fn.Name(), "Rpc")
+		}
+		if len(name) == 0 {
+			continue
+		}
+
+		m, err := ss.parseMethod(typeName, fn, name)
+		if err != nil {
+			return err
+		}
+		if isHttp {
+			httpRpcs = append(httpRpcs, m)
+		} else {
+			rpcs = append(rpcs, m)
+		}
+	}
+
+	proxyName := exportName(typeName) + "Proxy"
+	ss.genProxy(buf, typeName, proxyName, "Rpc", rpcs)
+	if len(httpRpcs) > 0 {
+		ss.genProxy(buf, typeName, exportName(typeName)+"HttpProxy", "HttpRpc", httpRpcs)
+	}
+	return nil
+}
+
+func (ss *generator) parseMethod(typeName string, fn *types.Func, name string) (*rpcMethod, error) {
+	where := fmt.Sprintf("%s.%s", typeName, fn.Name())
+	sig := fn.Type().(*types.Signature)
+	if sig.Variadic() {
+		return nil, fmt.Errorf("%s: variadic parameters are not supported", where)
+	}
+	if sig.Params().Len() == 0 || !isNodeType(sig.Params().At(0).Type(), "IRpcContext") {
+		return nil, fmt.Errorf("%s: first parameter must be node.IRpcContext", where)
+	}
+
+	m := &rpcMethod{name: name, target: fn.Name()}
+	used := map[string]bool{"ss": true}
+	for i := 1; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		pName := v.Name()
+		if len(pName) == 0 || pName == "_" || used[pName] || token.IsKeyword(pName) {
+			pName = "arg" + strconv.Itoa(i)
+		}
+		used[pName] = true
+		m.params = append(m.params, rpcParam{name: pName, typ: v.Type()})
+	}
+
+	var results []types.Type
+	if sig.Results().Len() > 0 {
+		// 直接返回结果的方法，末尾的 error 作为调用的错误
+		for i := 0; i < sig.Results().Len(); i++ {
+			results = append(results, sig.Results().At(i).Type())
+		}
+		if isErrorType(results[len(results)-1]) {
+			results = results[:len(results)-1]
+		}
+	} else {
+		src, fd := ss.findDecl(fn)
+		if fd == nil {
+			return nil, fmt.Errorf("%s: declaration not found", where)
+		}
+		var err error
+		if results, err = src.parseResults(ss.fset, fd); err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+	}
+	if len(results) > maxResults {
+		return nil, fmt.Errorf("%s: at most %d results are supported, got %d", where, maxResults, len(results))
+	}
+	m.results = results
+	return m, nil
+}
+
+// parseResults 优先使用方法注释中的 //snowgen:return，否则由 ctx.Return 的参数推断
+func (ss *pkgSource) parseResults(fset *token.FileSet, fd *ast.FuncDecl) ([]types.Type, error) {
+	if fd.Doc != nil {
+		for _, c := range fd.Doc.List {
+			if text, ok := strings.CutPrefix(c.Text, returnDirective); ok {
+				return ss.evalResults(fset, fd, strings.TrimSpace(text))
+			}
+		}
+	}
+
+	field := fd.Type.Params.List[0]
+	if len(field.Names) == 0 || field.Names[0].Name == "_" || fd.Body == nil {
+		return nil, nil
+	}
+	ctxObj := ss.info.Defs[field.Names[0]]
+
+	// ctx 作为选择器以外的用法视为传递给了其他函数，无法推断
+	selected := make(map[*ast.Ident]bool)
+	var returns [][]types.Type
+	var inferErr error
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := n.X.(*ast.Ident); ok && ss.info.Uses[id] == ctxObj {
+				selected[id] = true
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Return" {
+				return true
+			}
+			if id, ok := sel.X.(*ast.Ident); !ok || ss.info.Uses[id] != ctxObj {
+				return true
+			}
+			if n.Ellipsis.IsValid() {
+				inferErr = fmt.Errorf("cannot infer results from %s, add %s", fset.Position(n.Pos()), returnDirective)
+				return false
+			}
+
+			var ts []types.Type
+			for _, arg := range n.Args {
+				t := ss.info.TypeOf(arg)
+				if t == nil {
+					inferErr = fmt.Errorf("cannot infer type of %s at %s, add %s", types.ExprString(arg), fset.Position(arg.Pos()), returnDirective)
+					return false
+				}
+				if b, ok := t.(*types.Basic); ok && b.Info()&types.IsUntyped != 0 {
+					if b.Kind() == types.UntypedNil {
+						inferErr = fmt.Errorf("cannot infer type of nil at %s, add %s", fset.Position(arg.Pos()), returnDirective)
+						return false
+					}
+					t = types.Default(t)
+				}
+				ts = append(ts, t)
+			}
+			returns = append(returns, ts)
+		}
+		return true
+	})
+	if inferErr != nil {
+		return nil, inferErr
+	}
+
+	escaped := false
+	for id, obj := range ss.info.Uses {
+		if obj == ctxObj && !selected[id] && id.Pos() >= fd.Body.Pos() && id.Pos() < fd.Body.End() {
+			escaped = true
+			break
+		}
+	}
+	if len(returns) == 0 {
+		if escaped {
+			return nil, fmt.Errorf("ctx is passed elsewhere and no ctx.Return found, add %s", returnDirective)
+		}
+		return nil, nil
+	}
+
+	for _, ts := range returns[1:] {
+		if !slices.EqualFunc(ts, returns[0], types.Identical) {
+			return nil, fmt.Errorf("ctx.Return called with different types, add %s", returnDirective)
+		}
+	}
+	return returns[0], nil
+}
+
+func (ss *pkgSource) evalResults(fset *token.FileSet, fd *ast.FuncDecl, text string) ([]types.Type, error) {
+	if len(text) == 0 {
+		return nil, nil
+	}
+
+	expr, err := parser.ParseExpr("func() (" + text + ")")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %w", returnDirective, text, err)
+	}
+	var results []types.Type
+	for _, field := range expr.(*ast.FuncType).Results.List {
+		tv, err := types.Eval(fset, ss.pkg, fd.Pos(), types.ExprString(field.Type))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", returnDirective, text, err)
+		}
+		for range max(len(field.Names), 1) {
+			results = append(results, tv.Type)
+		}
+	}
+	return results, nil
+}
+
+func (ss *generator) genProxy(buf *bytes.Buffer, typeName, proxyName, prefix string, methods []*rpcMethod) {
+	node := ss.nodeQualifier()
+	slices.SortFunc(methods, func(a, b *rpcMethod) int { return strings.Compare(a.name, b.name) })
+
+	_, _ = fmt.Fprintf(buf, "// %s %s 的类型化代理，方法对应 %s 的 %s 方法\n", proxyName, typeName, typeName, prefix)
+	_, _ = fmt.Fprintf(buf, "type %s struct {\n\t%sIProxy\n}\n\n", proxyName, node)
+	_, _ = fmt.Fprintf(buf, "// New%s 将 proxy 包装为 %s\n", proxyName, proxyName)
+	_, _ = fmt.Fprintf(buf, "func New%s(proxy %sIProxy) %s {\n\treturn %s{IProxy: proxy}\n}\n", proxyName, node, proxyName, proxyName)
+
+	for _, m := range methods {
+		params := make([]string, 0, len(m.params))
+		args := []string{strconv.Quote(m.name)}
+		for _, p := range m.params {
+			params = append(params, p.name+" "+ss.typeString(p.typ))
+			args = append(args, p.name)
+		}
+
+		promise := fmt.Sprintf("%sPromise%d", node, len(m.results))
+		if len(m.results) > 0 {
+			results := make([]string, 0, len(m.results))
+			for _, t := range m.results {
+				results = append(results, ss.typeString(t))
+			}
+			promise += "[" + strings.Join(results, ", ") + "]"
+		}
+
+		_, _ = fmt.Fprintf(buf, "\n// %s 调用 %s.%s\n", m.name, typeName, m.target)
+		_, _ = fmt.Fprintf(buf, "func (ss %s) %s(%s) %s {\n", proxyName, m.name, strings.Join(params, ", "), promise)
+		_, _ = fmt.Fprintf(buf, "\treturn %s{IPromise: ss.IProxy.Call(%s)}\n}\n", promise, strings.Join(args, ", "))
+	}
+	buf.WriteString("\n")
+}
+
+func (ss *generator) nodeQualifier() string {
+	if ss.pkg.Path() == nodePkgPath {
+		return ""
+	}
+	return ss.importName(nodePkgPath, "node") + "."
+}
+
+func (ss *generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == ss.pkg {
+			return ""
+		}
+		return ss.importName(p.Path(), p.Name())
+	})
+}
+
+// importName 记录导入的包并返回其在生成代码中的包名，包名冲突时使用别名
+func (ss *generator) importName(path, name string) string {
+	if n, ok := ss.imports[path]; ok {
+		return n
+	}
+
+	alias := name
+	for i := 2; ; i++ {
+		if _, ok := ss.names[alias]; !ok {
+			break
+		}
+		alias = name + strconv.Itoa(i)
+	}
+	ss.imports[path] = alias
+	ss.names[alias] = path
+	return alias
+}
+
+func isNodeType(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == nodePkgPath && obj.Name() == name
+}
+
+func isErrorType(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+func defaultPkgName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func exportName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
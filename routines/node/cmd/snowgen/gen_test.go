@@ -0,0 +1,55 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join("testdata", "svc")
+	src, err := generate(dir, []string{"Rank"}, "rank_stub.go")
+	require.NoError(t, err)
+
+	out := string(src)
+	for _, s := range []string{
+		`// Code generated by "snowgen -type Rank"; DO NOT EDIT.`,
+		`func (ss RankProxy) Get(uid int64, arg2 string) node.Promise3[int64, string, int] {`,
+		`func (ss RankProxy) Set(uid int64, ttl time.Duration) node.Promise0 {`,
+		`func (ss RankProxy) Notify(ids []int64) node.Promise0 {`,
+		`func (ss RankProxy) Dump() node.Promise2[map[string]int, error] {`,
+		`func (ss RankProxy) Status() node.Promise1[string] {`,
+		`func (ss RankProxy) Score(uid int64) node.Promise1[int] {`,
+		`func (ss RankHttpProxy) Top(n int) node.Promise1[[]*Rank] {`,
+		`ss.IProxy.Call("Get", uid, arg2)`,
+	} {
+		require.Contains(t, out, s)
+	}
+	require.NotContains(t, out, "dump")
+
+	// 生成的代码与服务所在的包一同编译
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, code := range map[string]any{filepath.Join(dir, "svc.go"): nil, "rank_stub.go": src} {
+		f, err := parser.ParseFile(fset, name, code, 0)
+		require.NoError(t, err)
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: newImporter(fset, dir)}
+	_, err = conf.Check("svc", fset, files, nil)
+	require.NoError(t, err)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := filepath.Join("testdata", "svc")
+	_, err := generate(dir, []string{"Broken"}, "broken_stub.go")
+	require.ErrorContains(t, err, "Broken.RpcGet: ctx is passed elsewhere")
+
+	_, err = generate(dir, []string{"Missing"}, "missing_stub.go")
+	require.ErrorContains(t, err, "type Missing not found")
+}
@@ -0,0 +1,65 @@
+// snowgen 为服务的 Rpc 及 HttpRpc 方法生成类型化代理，调用参数及 Then 回调的类型在编译期检查
+//
+// 在服务所在的文件中添加：
+//
+//	//go:generate go run github.com/mogud/snow/routines/node/cmd/snowgen -type pong
+//
+// 执行 go generate 后生成 pong_stub.go，其中包含：
+//
+//	type PongProxy struct{ node.IProxy }              // Rpc 方法
+//	type PongHttpProxy struct{ node.IProxy }          // HttpRpc 方法，存在时生成
+//	func (ss PongProxy) Hello(msg string) node.Promise1[string]
+//
+// 方法声明了返回值时以其为准（末尾的 error 除外），否则返回值类型由方法中 ctx.Return(...) 的参数推断，无法推断时（如 ctx 传递给其他函数）在方法注释中指明：
+//
+//	//snowgen:return string, int
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of service type names; must be set")
+	output    = flag.String("output", "", "output file name; default <dir>/<type>_stub.go")
+)
+
+func usage() {
+	_, _ = fmt.Fprintf(os.Stderr, "Usage of snowgen:\n")
+	_, _ = fmt.Fprintf(os.Stderr, "\tsnowgen -type T[,T...] [-output file] [directory]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if len(*typeNames) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+	types := strings.Split(*typeNames, ",")
+
+	outName := *output
+	if len(outName) == 0 {
+		outName = filepath.Join(dir, strings.ToLower(types[0])+"_stub.go")
+	}
+
+	src, err := generate(dir, types, filepath.Base(outName))
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "snowgen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(outName, src, 0o644); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "snowgen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,57 @@
+package svc
+
+import (
+	"time"
+
+	"github.com/mogud/snow/routines/node"
+)
+
+type Rank struct {
+	node.Service
+}
+
+func (ss *Rank) RpcGet(ctx node.IRpcContext, uid int64, _ string) {
+	if uid == 0 {
+		ctx.Error(nil)
+		return
+	}
+	ctx.Return(uid, "name", 3)
+}
+
+func (ss *Rank) RpcSet(ctx node.IRpcContext, uid int64, ttl time.Duration) {
+	ss.After(ttl, func() {
+		ctx.Return()
+	})
+}
+
+func (ss *Rank) RpcNotify(_ node.IRpcContext, ids []int64) {
+}
+
+//snowgen:return map[string]int, error
+func (ss *Rank) RpcDump(ctx node.IRpcContext) {
+	ss.dump(ctx)
+}
+
+func (ss *Rank) HttpRpcTop(ctx node.IRpcContext, n int) {
+	ctx.Return([]*Rank{})
+}
+
+func (ss *Rank) dump(ctx node.IRpcContext) {
+	ctx.Return(map[string]int{}, nil)
+}
+
+type Broken struct {
+	node.Service
+}
+
+func (ss *Broken) RpcGet(ctx node.IRpcContext) {
+	ss.reply(ctx)
+}
+
+func (ss *Broken) reply(ctx node.IRpcContext) {
+	ctx.Return(1)
+}
+
+func (ss *Rank) RpcScore(ctx node.IRpcContext, uid int64) (int, error) {
+	return 0, nil
+}
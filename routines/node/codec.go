@@ -0,0 +1,38 @@
+package node
+
+import (
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ICodec RPC 参数编解码器，远端连接建立时按名称协商
+type ICodec interface {
+	// Name 编解码器名称，连接两端必须一致
+	Name() string
+	// Marshal 编码参数列表
+	Marshal(args []any) ([]byte, error)
+	// Unmarshal 解码参数列表，ptrs 中的元素为指向目标类型的指针；若参数为空，则对应元素置为 nil
+	Unmarshal(data []byte, ptrs []any) error
+}
+
+var (
+	JsonCodec   ICodec = jsonCodec{}
+	BinaryCodec ICodec = binaryCodec{}
+)
+
+var defaultCodec = JsonCodec
+
+var _ ICodec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (ss jsonCodec) Name() string {
+	return "json"
+}
+
+func (ss jsonCodec) Marshal(args []any) ([]byte, error) {
+	return jsoniter.ConfigDefault.Marshal(args)
+}
+
+func (ss jsonCodec) Unmarshal(data []byte, ptrs []any) error {
+	return jsoniter.ConfigDefault.Unmarshal(data, &ptrs)
+}
@@ -0,0 +1,407 @@
+package node
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var _ ICodec = binaryCodec{}
+
+var (
+	binaryMarshalerType   = reflect.TypeFor[encoding.BinaryMarshaler]()
+	binaryUnmarshalerType = reflect.TypeFor[encoding.BinaryUnmarshaler]()
+)
+
+var (
+	errBinaryShortBuffer  = errors.New("binary codec: short buffer")
+	errBinaryTooManyElems = errors.New("binary codec: too many elements")
+)
+
+// binaryMaxZeroSizeElems 元素编码长度为 0 时无法依据剩余数据校验个数，以此为上限
+const binaryMaxZeroSizeElems = 1 << 16
+
+// binaryCodec 基于反射的紧凑二进制编解码器
+//
+// 整数使用 varint 编码，因此两端整数位宽可以不同；结构体按导出字段顺序编码，不含字段名，
+// 两端结构体定义必须一致；实现了 encoding.BinaryMarshaler 的类型使用其自身编码；不支持接口、通道及函数类型。
+type binaryCodec struct{}
+
+func (ss binaryCodec) Name() string {
+	return "binary"
+}
+
+func (ss binaryCodec) Marshal(args []any) ([]byte, error) {
+	buf := binary.AppendUvarint(make([]byte, 0, 64), uint64(len(args)))
+	for _, arg := range args {
+		v := reflect.ValueOf(arg)
+		if !v.IsValid() || (v.Kind() == reflect.Pointer && v.IsNil()) {
+			buf = append(buf, 0)
+			continue
+		}
+
+		buf = append(buf, 1)
+		var err error
+		if buf, err = binaryEncode(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func (ss binaryCodec) Unmarshal(data []byte, ptrs []any) error {
+	n, l := binary.Uvarint(data)
+	if l <= 0 {
+		return errBinaryShortBuffer
+	}
+	data = data[l:]
+
+	for i := 0; i < int(n); i++ {
+		if len(data) < 1 {
+			return errBinaryShortBuffer
+		}
+		present := data[0]
+		data = data[1:]
+
+		if i >= len(ptrs) {
+			// 多余的参数直接跳过，与 json 行为一致
+			if present == 0 {
+				continue
+			}
+			return nil
+		}
+
+		if present == 0 {
+			ptrs[i] = nil
+			continue
+		}
+
+		v := reflect.ValueOf(ptrs[i])
+		if v.Kind() != reflect.Pointer || v.IsNil() {
+			return fmt.Errorf("binary codec: argument %d is not a pointer", i)
+		}
+
+		var err error
+		if data, err = binaryDecode(data, v.Elem()); err != nil {
+			return fmt.Errorf("binary codec: argument %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func binaryEncode(buf []byte, v reflect.Value) ([]byte, error) {
+	if binaryUseMarshaler(v.Type()) {
+		bs, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(bs)))
+		return append(buf, bs...), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		buf = binary.AppendUvarint(buf, uint64(v.Len()))
+		return append(buf, v.String()...), nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		return binaryEncode(append(buf, 1), v.Elem())
+	case reflect.Slice:
+		// 长度加一编码，0 代表 nil
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len())+1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append(buf, v.Bytes()...), nil
+		}
+		return binaryEncodeElems(buf, v)
+	case reflect.Array:
+		return binaryEncodeElems(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(v.Len())+1)
+		var err error
+		iter := v.MapRange()
+		for iter.Next() {
+			if buf, err = binaryEncode(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = binaryEncode(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Struct:
+		var err error
+		ty := v.Type()
+		for i := 0; i < ty.NumField(); i++ {
+			if !ty.Field(i).IsExported() {
+				continue
+			}
+			if buf, err = binaryEncode(buf, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("binary codec: unsupported type %v", v.Type())
+	}
+}
+
+// binaryUseMarshaler 类型同时支持 encoding.BinaryMarshaler 及 encoding.BinaryUnmarshaler 时使用其自身编码
+func binaryUseMarshaler(ty reflect.Type) bool {
+	return ty.Kind() != reflect.Pointer && ty.Implements(binaryMarshalerType) && reflect.PointerTo(ty).Implements(binaryUnmarshalerType)
+}
+
+func binaryEncodeElems(buf []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = binaryEncode(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func binaryDecode(data []byte, v reflect.Value) ([]byte, error) {
+	if binaryUseMarshaler(v.Type()) {
+		n, err := binaryReadBytesLen(&data)
+		if err != nil {
+			return nil, err
+		}
+		if err = v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data[:n]); err != nil {
+			return nil, err
+		}
+		return data[n:], nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if len(data) < 1 {
+			return nil, errBinaryShortBuffer
+		}
+		v.SetBool(data[0] != 0)
+		return data[1:], nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, l := binary.Varint(data)
+		if l <= 0 {
+			return nil, errBinaryShortBuffer
+		}
+		v.SetInt(x)
+		return data[l:], nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, l := binary.Uvarint(data)
+		if l <= 0 {
+			return nil, errBinaryShortBuffer
+		}
+		v.SetUint(x)
+		return data[l:], nil
+	case reflect.Float32:
+		if len(data) < 4 {
+			return nil, errBinaryShortBuffer
+		}
+		v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))))
+		return data[4:], nil
+	case reflect.Float64:
+		if len(data) < 8 {
+			return nil, errBinaryShortBuffer
+		}
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)))
+		return data[8:], nil
+	case reflect.String:
+		n, err := binaryReadBytesLen(&data)
+		if err != nil {
+			return nil, err
+		}
+		v.SetString(string(data[:n]))
+		return data[n:], nil
+	case reflect.Pointer:
+		if len(data) < 1 {
+			return nil, errBinaryShortBuffer
+		}
+		if data[0] == 0 {
+			v.SetZero()
+			return data[1:], nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return binaryDecode(data[1:], v.Elem())
+	case reflect.Slice:
+		n, err := binaryReadLen(&data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			v.SetZero()
+			return data, nil
+		}
+		n--
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if len(data) < n {
+				return nil, errBinaryShortBuffer
+			}
+			bs := reflect.MakeSlice(v.Type(), n, n)
+			reflect.Copy(bs, reflect.ValueOf(data[:n]))
+			v.Set(bs)
+			return data[n:], nil
+		}
+		// 元素逐个追加，避免依据不可信的长度预先分配过大内存
+		ty := v.Type()
+		if err = binaryCheckLen(n, len(data), binaryMinSize(ty.Elem())); err != nil {
+			return nil, err
+		}
+		elems := reflect.MakeSlice(ty, 0, min(n, len(data)))
+		for i := 0; i < n; i++ {
+			elem := reflect.New(ty.Elem()).Elem()
+			if data, err = binaryDecode(data, elem); err != nil {
+				return nil, err
+			}
+			elems = reflect.Append(elems, elem)
+		}
+		v.Set(elems)
+		return data, nil
+	case reflect.Array:
+		return binaryDecodeElems(data, v)
+	case reflect.Map:
+		n, err := binaryReadLen(&data)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			v.SetZero()
+			return data, nil
+		}
+		n--
+		ty := v.Type()
+		if err = binaryCheckLen(n, len(data), binaryMinSize(ty.Key())+binaryMinSize(ty.Elem())); err != nil {
+			return nil, err
+		}
+		m := reflect.MakeMapWithSize(ty, min(n, len(data)))
+		for i := 0; i < n; i++ {
+			key := reflect.New(ty.Key()).Elem()
+			if data, err = binaryDecode(data, key); err != nil {
+				return nil, err
+			}
+			val := reflect.New(ty.Elem()).Elem()
+			if data, err = binaryDecode(data, val); err != nil {
+				return nil, err
+			}
+			m.SetMapIndex(key, val)
+		}
+		v.Set(m)
+		return data, nil
+	case reflect.Struct:
+		var err error
+		ty := v.Type()
+		for i := 0; i < ty.NumField(); i++ {
+			if !ty.Field(i).IsExported() {
+				continue
+			}
+			if data, err = binaryDecode(data, v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %v", v.Type())
+	}
+}
+
+// binaryCheckLen 校验不可信的元素个数，每个元素至少占用 minSize 字节
+func binaryCheckLen(n, remain, minSize int) error {
+	if minSize > 0 {
+		if n > remain/minSize {
+			return errBinaryShortBuffer
+		}
+		return nil
+	}
+	if n > binaryMaxZeroSizeElems {
+		return errBinaryTooManyElems
+	}
+	return nil
+}
+
+// binaryMinSize 类型编码后的最小字节数，空结构体及其数组为 0
+func binaryMinSize(ty reflect.Type) int {
+	if binaryUseMarshaler(ty) {
+		return 1
+	}
+
+	switch ty.Kind() {
+	case reflect.Float32:
+		return 4
+	case reflect.Float64:
+		return 8
+	case reflect.Array:
+		return ty.Len() * binaryMinSize(ty.Elem())
+	case reflect.Struct:
+		size := 0
+		for i := 0; i < ty.NumField(); i++ {
+			if ty.Field(i).IsExported() {
+				size += binaryMinSize(ty.Field(i).Type)
+			}
+		}
+		return size
+	default:
+		return 1
+	}
+}
+
+func binaryDecodeElems(data []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if data, err = binaryDecode(data, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// binaryReadLen 读取长度，不移除该长度对应的数据
+func binaryReadLen(data *[]byte) (int, error) {
+	x, l := binary.Uvarint(*data)
+	if l <= 0 {
+		return 0, errBinaryShortBuffer
+	}
+	*data = (*data)[l:]
+
+	n := int(x)
+	if n < 0 || uint64(n) != x {
+		return 0, errBinaryShortBuffer
+	}
+	return n, nil
+}
+
+// binaryReadBytesLen 读取字节长度，并保证剩余数据至少包含该长度
+func binaryReadBytesLen(data *[]byte) (int, error) {
+	n, err := binaryReadLen(data)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(*data) {
+		return 0, errBinaryShortBuffer
+	}
+	return n, nil
+}
@@ -0,0 +1,176 @@
+package node
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type codecTestItem struct {
+	ID    int64
+	Name  string
+	Tags  []string
+	Attrs map[string]int32
+	Next  *codecTestItem
+	Time  time.Time
+	inner int
+}
+
+func TestCodecRoundTripRequestArgs(t *testing.T) {
+	item := &codecTestItem{
+		ID:    1<<62 + 1,
+		Name:  "snow",
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]int32{"x": -1},
+		Next:  &codecTestItem{ID: 2},
+		Time:  time.Unix(1700000000, 123).UTC(),
+	}
+	handler := func(_ *Service, _ IRpcContext, id int64, item *codecTestItem, data []byte, ok bool, f float64) {}
+
+	for _, codec := range []ICodec{JsonCodec, BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			req := &message{src: 1, dst: 2, sess: 3, codec: codec}
+			req.writeRequest("Test", []any{int64(1<<62 + 1), item, []byte{1, 2, 3}, true, 1.5})
+			bs, err := req.marshal()
+			require.NoError(t, err)
+
+			recv := &message{}
+			require.NoError(t, recv.unmarshal(bs))
+			recv.codec = codec
+			name, err := recv.getRequestFunc()
+			require.NoError(t, err)
+			require.Equal(t, "Test", name)
+
+			args, err := recv.getRequestFuncArgs(reflect.TypeOf(handler))
+			require.NoError(t, err)
+			require.Len(t, args, 5)
+			require.Equal(t, int64(1<<62+1), args[0].Int())
+			got := args[1].Interface().(*codecTestItem)
+			require.Equal(t, item.ID, got.ID)
+			require.Equal(t, item.Tags, got.Tags)
+			require.Equal(t, item.Attrs, got.Attrs)
+			require.Equal(t, item.Next.ID, got.Next.ID)
+			require.True(t, item.Time.Equal(got.Time))
+			require.Equal(t, []byte{1, 2, 3}, args[2].Bytes())
+			require.True(t, args[3].Bool())
+			require.Equal(t, 1.5, args[4].Float())
+		})
+	}
+}
+
+func TestCodecNilResponseArgsBecomeZero(t *testing.T) {
+	then := func(item *codecTestItem, name string) {}
+
+	for _, codec := range []ICodec{JsonCodec, BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			rsp := &message{src: 1, dst: 2, sess: -3, codec: codec}
+			rsp.writeResponse(nil, "ok")
+			bs, err := rsp.marshal()
+			require.NoError(t, err)
+
+			recv := &message{codec: codec}
+			require.NoError(t, recv.unmarshal(bs))
+			args, err := recv.getResponse(reflect.TypeOf(then))
+			require.NoError(t, err)
+			require.Len(t, args, 2)
+			require.True(t, args[0].IsNil())
+			require.Equal(t, "ok", args[1].String())
+		})
+	}
+}
+
+func TestBinaryCodecRejectsTruncatedData(t *testing.T) {
+	bs, err := BinaryCodec.Marshal([]any{"hello", []int{1, 2, 3}})
+	require.NoError(t, err)
+
+	for i := 0; i < len(bs); i++ {
+		var s string
+		var ints []int
+		require.Error(t, BinaryCodec.Unmarshal(bs[:i], []any{&s, &ints}))
+	}
+}
+
+func TestBinaryCodecRejectsOversizedLength(t *testing.T) {
+	// 参数个数 1、存在标记 1、之后为元素个数加一的 varint
+	forge := func(n uint64) []byte {
+		return binary.AppendUvarint([]byte{1, 1}, n+1)
+	}
+
+	var empty []struct{}
+	require.ErrorIs(t, BinaryCodec.Unmarshal(forge(math.MaxUint32), []any{&empty}), errBinaryTooManyElems)
+	var ints []struct{ A, B int }
+	require.ErrorIs(t, BinaryCodec.Unmarshal(forge(3), []any{&ints}), errBinaryShortBuffer)
+	var m map[struct{}]struct{}
+	require.ErrorIs(t, BinaryCodec.Unmarshal(forge(math.MaxUint32), []any{&m}), errBinaryTooManyElems)
+
+	bs, err := BinaryCodec.Marshal([]any{make([]struct{}, 3)})
+	require.NoError(t, err)
+	require.NoError(t, BinaryCodec.Unmarshal(bs, []any{&empty}))
+	require.Len(t, empty, 3)
+}
+
+func TestHandshakeNegotiatesClientPreferredCommonCodec(t *testing.T) {
+	client, server := loopbackTCPPair(t)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	clientNode := &Node{
+		nodeOpt:  &Option{Compression: true},
+		codecs:   []ICodec{BinaryCodec, JsonCodec},
+		codecMap: map[string]ICodec{BinaryCodec.Name(): BinaryCodec, JsonCodec.Name(): JsonCodec},
+	}
+	serverNode := &Node{
+		nodeOpt:  &Option{},
+		codecs:   []ICodec{JsonCodec, BinaryCodec},
+		codecMap: map[string]ICodec{BinaryCodec.Name(): BinaryCodec, JsonCodec.Name(): JsonCodec},
+	}
+
+	done := make(chan *handshakeResult, 1)
+	go func() {
+		result, err := serverNode.serverHandshake(server)
+		require.NoError(t, err)
+		done <- result
+	}()
+
+	result, err := clientNode.clientHandshake(client)
+	require.NoError(t, err)
+	require.Equal(t, BinaryCodec, result.codec)
+	require.False(t, result.compress)
+
+	result = <-done
+	require.Equal(t, BinaryCodec, result.codec)
+	require.False(t, result.compress)
+}
+
+func TestHandshakeRejectsProtocolVersionMismatch(t *testing.T) {
+	client, server := loopbackTCPPair(t)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	serverNode := &Node{
+		nodeOpt:  &Option{},
+		codecs:   []ICodec{JsonCodec},
+		codecMap: map[string]ICodec{JsonCodec.Name(): JsonCodec},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := serverNode.serverHandshake(server)
+		done <- err
+	}()
+
+	// 未携带版本的旧节点
+	require.NoError(t, writeHandshakeFrame(client, &handshakeHello{Codecs: []string{JsonCodec.Name()}}))
+	reply := &handshakeReply{}
+	require.NoError(t, readHandshakeFrame(client, reply))
+	require.Empty(t, reply.Codec)
+	require.Equal(t, protocolVersion, reply.Version)
+	require.ErrorContains(t, <-done, "protocol version mismatch")
+}
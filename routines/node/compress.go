@@ -0,0 +1,61 @@
+package node
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// frameCompressedFlag 帧长度最高位为 1 代表帧内容为 zstd 压缩后的若干条消息
+	frameCompressedFlag = 0x80000000
+	frameLenMask        = 0x7fffffff
+
+	defaultCompressThreshold = 1024
+	maxDecompressedFrameLen  = 64 * 1024 * 1024
+)
+
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		panic(fmt.Sprintf("create zstd encoder: %v", err))
+	}
+	return enc
+})
+
+var zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecompressedFrameLen))
+	if err != nil {
+		panic(fmt.Sprintf("create zstd decoder: %v", err))
+	}
+	return dec
+})
+
+// compressFrame 压缩若干条已编码的消息，若压缩后未变小则返回 nil
+func compressFrame(raw []byte) []byte {
+	buf := zstdEncoder().EncodeAll(raw, make([]byte, 4, 4+len(raw)/2))
+	if len(buf) >= len(raw) || len(buf) > frameLenMask {
+		return nil
+	}
+
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf))|frameCompressedFlag)
+	return buf
+}
+
+// decompressFrame 解压帧内容，frame 包含 4 字节帧头
+func decompressFrame(frame []byte) ([]byte, error) {
+	return zstdDecoder().DecodeAll(frame[4:], nil)
+}
+
+// compressMetric 压缩指标，仅在压缩发生时上报
+func compressMetric(mc IMetricCollector, raw, compressed int) {
+	if mc == nil {
+		return
+	}
+
+	mc.Counter("[NodeCompress] raw bytes", uint64(raw))
+	mc.Counter("[NodeCompress] compressed bytes", uint64(compressed))
+	mc.Histogram("[NodeCompress] ratio", float64(compressed)/float64(raw))
+}
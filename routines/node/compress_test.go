@@ -0,0 +1,58 @@
+package node
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteHandleCompressedFrameRoundTrip(t *testing.T) {
+	testNode := &Node{regOpt: &RegisterOption{}}
+	sender := newRemoteHandle(testNode, Addr(101), nil)
+	sender.applyHandshake(&handshakeResult{codec: JsonCodec, compress: true})
+	sender.connected.Store(true)
+	receiver := newRemoteHandle(testNode, Addr(102), nil)
+	receiver.applyHandshake(&handshakeResult{codec: JsonCodec, compress: true})
+
+	payload := strings.Repeat("snow", 1024)
+	var got []string
+	for sess := int32(1); sess <= 3; sess++ {
+		receiver.sessCb.Store(sess, &session{cb: func(m *message) {
+			args, err := m.getResponse(reflect.TypeFor[func(string)]())
+			require.NoError(t, err)
+			got = append(got, args[0].String())
+		}})
+
+		rsp := &message{src: 1, dst: 2, sess: -sess}
+		rsp.writeResponse(payload)
+		sender.send(rsp)
+	}
+	sender.onTick()
+
+	frame := <-sender.wBuf
+	require.NotZero(t, binary.LittleEndian.Uint32(frame)&frameCompressedFlag)
+	require.Less(t, len(frame), len(payload))
+
+	// 分两次到达，模拟半包
+	rest := receiver.doDivide(frame[:len(frame)/2])
+	require.Len(t, rest, len(frame)/2)
+	rest = receiver.doDivide(append(rest, frame[len(frame)/2:]...))
+	require.Empty(t, rest)
+	require.NotNil(t, rest)
+	require.Equal(t, []string{payload, payload, payload}, got)
+}
+
+func TestRemoteHandleSkipsCompressionBelowThreshold(t *testing.T) {
+	sender := newRemoteHandle(&Node{regOpt: &RegisterOption{}}, Addr(101), nil)
+	sender.applyHandshake(&handshakeResult{codec: JsonCodec, compress: true})
+	sender.connected.Store(true)
+
+	sender.send(nil)
+	sender.onTick()
+
+	frame := <-sender.wBuf
+	require.Equal(t, []byte{4, 0, 0, 0}, frame)
+}
@@ -92,13 +92,20 @@ func (ss *Node) initOptions() {
 	}
 
 	var err error
-	ss.tcpListener, err = net.Listen("tcp4", curHost+":"+strconv.Itoa(curPort))
+	if ss.tls, err = newTlsReloader(ss.nodeOpt); err != nil {
+		panic(fmt.Sprintf("node tls config error: %+v", err))
+	}
+	if ss.sendQueuePolicy, err = parseSendQueuePolicy(ss.nodeOpt.SendQueuePolicy); err != nil {
+		panic(fmt.Sprintf("node send queue config error: %+v", err))
+	}
+
+	ss.tcpListener, err = net.Listen("tcp", net.JoinHostPort(curHost, strconv.Itoa(curPort)))
 	if err != nil {
 		panic(fmt.Sprintf("node tcp listen at port %v failed: %+v", curPort, err))
 	}
 
 	listenConfig := &net.ListenConfig{KeepAlive: time.Duration(ss.nodeOpt.HttpKeepAliveSeconds) * time.Second}
-	ss.httpListener, err = listenConfig.Listen(context.Background(), "tcp", curHost+":"+strconv.Itoa(curHttpPort))
+	ss.httpListener, err = listenConfig.Listen(context.Background(), "tcp", net.JoinHostPort(curHost, strconv.Itoa(curHttpPort)))
 	if err != nil {
 		panic(fmt.Sprintf("node http listen at port %v failed: %+v", curPort, err))
 	}
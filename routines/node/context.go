@@ -1,24 +1,38 @@
 package node
 
+import "time"
+
 var _ = (IRpcContext)((*rpcContext)(nil))
 
+// callKey 被调用方标识一次调用：调用方节点、服务地址及会话
+type callKey struct {
+	nAddr Addr
+	src   int32
+	sess  int32
+}
+
 type rpcContext struct {
 	reqSess     int32
 	reqSrc      int32
 	reqCb       func(m *message)
 	reqNodeAddr Addr
+	reqPeer     string
 
-	mRsp    *message
-	srv     *Service
-	flushed bool
-	flushCb func()
+	mRsp     *message
+	srv      *Service
+	deadline int64
+	flushed  bool
+	canceled bool
+	flushCb  func(err error)
+	stream   *rpcStream
 }
 
-func newRpcContext(srv *Service, mRsp *message, reqSess, reqSrc int32, reqNodeAddr Addr, reqCb func(m *message), flushCb func()) *rpcContext {
+func newRpcContext(srv *Service, mRsp *message, reqSess, reqSrc int32, reqNodeAddr Addr, reqPeer string, reqCb func(m *message), flushCb func(err error)) *rpcContext {
 	return &rpcContext{
 		reqSess:     reqSess,
 		reqSrc:      reqSrc,
 		reqNodeAddr: reqNodeAddr,
+		reqPeer:     reqPeer,
 		reqCb:       reqCb,
 
 		mRsp:    mRsp,
@@ -35,6 +49,14 @@ func (ss *rpcContext) GetRemoteServiceAddr() int32 {
 	return ss.reqSrc
 }
 
+func (ss *rpcContext) GetRemotePeerName() string {
+	return ss.reqPeer
+}
+
+func (ss *rpcContext) GetTraceID() int64 {
+	return ss.mRsp.trace
+}
+
 func (ss *rpcContext) Catch(f func(error)) IRpcContext {
 	ss.mRsp.cb = func(m *message) {
 		f(m.err)
@@ -43,41 +65,101 @@ func (ss *rpcContext) Catch(f func(error)) IRpcContext {
 }
 
 func (ss *rpcContext) Return(args ...any) {
+	if ss.flushed {
+		return
+	}
 	ss.mRsp.writeResponse(args...)
 	ss.flush()
 }
 
 func (ss *rpcContext) Error(err error) {
+	if ss.flushed {
+		return
+	}
 	ss.mRsp.err = err
 	ss.mRsp.src = 0
 	ss.flush()
 }
 
+func (ss *rpcContext) Stream() IRpcStream {
+	if ss.stream == nil {
+		return nil
+	}
+	return ss.stream
+}
+
+func (ss *rpcContext) Deadline() (time.Time, bool) {
+	if ss.deadline == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ss.deadline), true
+}
+
+func (ss *rpcContext) Canceled() bool {
+	return ss.canceled
+}
+
+func (ss *rpcContext) key() callKey {
+	return callKey{nAddr: ss.reqNodeAddr, src: ss.reqSrc, sess: ss.reqSess}
+}
+
 func (ss *rpcContext) flush() {
 	if ss.flushed {
 		return
 	}
+	// 流中缓存的消息发送完毕后再发送最终响应
+	if ss.stream != nil && !ss.stream.close() {
+		return
+	}
 	ss.flushed = true
+	ss.srv.untrackCall(ss)
+
+	err := ss.mRsp.err
+	if ss.canceled {
+		err = ErrRequestCanceled
+	}
 	if ss.flushCb != nil {
-		ss.flushCb()
+		ss.flushCb(err)
 	}
 
+	if ss.canceled {
+		// 调用方已放弃，不再响应
+		ss.mRsp.clear()
+		return
+	}
+	ss.sendResponse(ss.mRsp)
+}
+
+// cancel 调用方取消，流随之取消，之后的 Return 及 Error 不再响应
+func (ss *rpcContext) cancel() {
+	if ss.flushed || ss.canceled {
+		return
+	}
+	ss.canceled = true
+	ss.srv.untrackCall(ss)
+	if ss.stream != nil {
+		ss.stream.cancel()
+	}
+}
+
+// sendResponse 向调用方发送响应，返回是否发出
+func (ss *rpcContext) sendResponse(mRsp *message) bool {
 	reqSess := ss.reqSess
 	reqSrc := ss.reqSrc
 	reqNodeAddr := ss.reqNodeAddr
 	reqCb := ss.reqCb
-	mRsp := ss.mRsp
 	if reqSess > 0 {
 		if reqCb != nil { // local service message
 			reqCb(mRsp)
+			return true
 		} else if reqNodeAddr != 0 { // must be remote message
 			sender := nodeGetMessageSender(reqNodeAddr, reqSrc, false, nil)
 			if sender != nil {
-				sender.send(mRsp)
-			} else {
-				ss.srv.Errorf("service at nAddr(%v) sAddr(%#8x) not found when rpc return", reqNodeAddr, reqSrc)
-				mRsp.clear()
+				return sender.send(mRsp)
 			}
+			ss.srv.Errorf("service at nAddr(%v) sAddr(%#8x) not found when rpc return", reqNodeAddr, reqSrc)
+			mRsp.clear()
 		} // else is a local post
 	}
+	return false
 }
@@ -3,18 +3,22 @@ package node
 import (
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
+	"time"
 )
 
 var _ IRpcContext = (*httpRpcContext)(nil)
 
 type httpRpcContext struct {
-	ch   chan *httpResponse
-	errF func(error)
+	ch        chan *httpResponse
+	errF      func(error)
+	trace     int64
+	responded bool
 }
 
-func newHttpRpcContext(ch chan *httpResponse) *httpRpcContext {
+func newHttpRpcContext(ch chan *httpResponse, trace int64) *httpRpcContext {
 	return &httpRpcContext{
-		ch: ch,
+		ch:    ch,
+		trace: trace,
 	}
 }
 
@@ -26,15 +30,24 @@ func (ss *httpRpcContext) GetRemoteServiceAddr() int32 {
 	return 0
 }
 
+func (ss *httpRpcContext) GetRemotePeerName() string {
+	return ""
+}
+
+func (ss *httpRpcContext) GetTraceID() int64 {
+	return ss.trace
+}
+
 func (ss *httpRpcContext) Catch(f func(error)) IRpcContext {
 	ss.errF = f
 	return ss
 }
 
 func (ss *httpRpcContext) Return(args ...any) {
-	if ss.ch == nil {
+	if ss.ch == nil || ss.responded {
 		return
 	}
+	ss.responded = true
 
 	if args == nil {
 		args = make([]any, 0)
@@ -55,9 +68,10 @@ func (ss *httpRpcContext) Return(args ...any) {
 }
 
 func (ss *httpRpcContext) Error(err error) {
-	if ss.ch == nil {
+	if ss.ch == nil || ss.responded {
 		return
 	}
+	ss.responded = true
 
 	ss.ch <- &httpResponse{
 		StatusCode: http.StatusBadRequest,
@@ -65,6 +79,18 @@ func (ss *httpRpcContext) Error(err error) {
 	}
 }
 
+func (ss *httpRpcContext) Stream() IRpcStream {
+	return nil
+}
+
+func (ss *httpRpcContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (ss *httpRpcContext) Canceled() bool {
+	return false
+}
+
 func (ss *httpRpcContext) onError(err error) {
 	ss.errF(err)
 }
@@ -0,0 +1,194 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mogud/snow/core/debug"
+)
+
+var ErrCoroutineCanceled = fmt.Errorf("coroutine canceled")
+
+// Co 服务协程，由 Service.Go 创建
+//
+// 协程运行于独立的 goroutine，但与服务主线程严格交替执行：协程运行时主线程阻塞等待，协程挂起后主线程继续，
+// 因此协程中可以像在主线程中一样直接访问服务状态
+type Co interface {
+	// Sleep 挂起协程 d 时间，期间服务主线程照常处理消息
+	Sleep(d time.Duration) error
+	// Canceled 协程是否已被取消，服务停止时取消全部协程，之后的 Await 及 Sleep 立即返回 ErrCoroutineCanceled
+	Canceled() bool
+
+	wait(p IPromise) error
+}
+
+// Await 发起调用并挂起协程直至返回，p 不应设置 Then、Catch 及 Final
+//
+//	ss.Go(func(co node.Co) {
+//		name, err := node.Await[string](co, proxy.Call("GetName", id).Timeout(time.Second))
+//		...
+//	})
+func Await[T any](co Co, p IPromise) (T, error) {
+	var r T
+	err := co.wait(p.Then(func(v T) { r = v }))
+	return r, err
+}
+
+// Await2 同 Await，用于返回两个值的调用
+func Await2[T1, T2 any](co Co, p IPromise) (T1, T2, error) {
+	var r1 T1
+	var r2 T2
+	err := co.wait(p.Then(func(v1 T1, v2 T2) { r1, r2 = v1, v2 }))
+	return r1, r2, err
+}
+
+// AwaitDone 同 Await，用于无返回值的调用或 PromiseAll 等组合调用
+func AwaitDone(co Co, p IPromise) error {
+	return co.wait(p)
+}
+
+var _ Co = (*coroutine)(nil)
+
+type coroutine struct {
+	srv      *Service
+	resumeCh chan struct{}
+	yieldCh  chan struct{}
+
+	cur       *coWait  // 当前挂起等待的事件
+	awaiting  IPromise // 当前等待的调用
+	panicked  any      // 协程中恢复的 panic，由主线程交给监督策略
+	canceled  bool
+	suspended bool
+	finished  bool
+}
+
+type coWait struct {
+	ready bool
+}
+
+// Go 启动协程，f 立即执行直至首次挂起，须在服务主线程中调用
+func (ss *Service) Go(f func(co Co)) {
+	co := &coroutine{
+		srv:      ss,
+		resumeCh: make(chan struct{}),
+		yieldCh:  make(chan struct{}),
+		canceled: ss.coCanceled,
+	}
+	if ss.coroutines == nil {
+		ss.coroutines = make(map[*coroutine]struct{})
+	}
+	ss.coroutines[co] = struct{}{}
+
+	go func() {
+		<-co.resumeCh
+		defer func() {
+			if err := recover(); err != nil {
+				buf := debug.StackInfo()
+				ss.Errorf("service coroutine execute error: %v\n%s", err, buf)
+				co.panicked = err
+			}
+			co.finished = true
+			delete(ss.coroutines, co)
+			co.yieldCh <- struct{}{}
+		}()
+
+		f(co)
+	}()
+	co.resume()
+}
+
+// cancelCoroutines 取消全部挂起的协程，须在服务主线程中调用
+func (ss *Service) cancelCoroutines() {
+	ss.coCanceled = true
+	for co := range ss.coroutines {
+		co.canceled = true
+		if co.awaiting != nil {
+			// 等待中的调用随协程取消，被调用方不再处理
+			co.awaiting.Cancel()
+		}
+		if co.suspended {
+			co.resume()
+		}
+	}
+}
+
+func (ss *coroutine) Sleep(d time.Duration) error {
+	if ss.canceled {
+		return ErrCoroutineCanceled
+	}
+
+	w := &coWait{}
+	h := ss.srv.After(d, func() {
+		ss.wake(w)
+	})
+	ss.suspend(w)
+	if !w.ready {
+		h.Stop()
+		return ErrCoroutineCanceled
+	}
+	return nil
+}
+
+func (ss *coroutine) Canceled() bool {
+	return ss.canceled
+}
+
+func (ss *coroutine) wait(p IPromise) error {
+	if ss.canceled {
+		return ErrCoroutineCanceled
+	}
+
+	var err error
+	w := &coWait{}
+	p.Catch(func(e error) {
+		err = e
+	}).Final(func() {
+		ss.wake(w)
+	}).Done()
+	ss.awaiting = p
+	ss.suspend(w)
+	ss.awaiting = nil
+
+	if !w.ready {
+		return ErrCoroutineCanceled
+	}
+	return err
+}
+
+// suspend 挂起协程直至 w 就绪或协程被取消，于协程中调用
+func (ss *coroutine) suspend(w *coWait) {
+	// 回调可能在发起调用时同步执行
+	if w.ready {
+		return
+	}
+
+	ss.cur = w
+	ss.suspended = true
+	ss.yieldCh <- struct{}{}
+	<-ss.resumeCh
+	ss.cur = nil
+}
+
+// wake 标记 w 就绪，若协程正挂起等待 w 则恢复执行，于服务主线程中调用
+func (ss *coroutine) wake(w *coWait) {
+	w.ready = true
+	if ss.suspended && ss.cur == w {
+		ss.resume()
+	}
+}
+
+// resume 切换到协程执行，直至协程再次挂起或结束，于服务主线程中调用
+func (ss *coroutine) resume() {
+	if ss.finished {
+		return
+	}
+
+	ss.suspended = false
+	ss.resumeCh <- struct{}{}
+	<-ss.yieldCh
+
+	if v := ss.panicked; v != nil {
+		ss.panicked = nil
+		ss.srv.onPanic(v)
+	}
+}
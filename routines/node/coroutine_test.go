@@ -0,0 +1,86 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoroutineAwaitsSequentialCalls(t *testing.T) {
+	srv, now := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var steps []string
+	var errs []error
+	srv.Go(func(co Co) {
+		name, err := Await[string](co, inner.Call("GetName"))
+		steps = append(steps, "name:"+name)
+		errs = append(errs, err)
+
+		_, err = Await[int](co, inner.Call("GetAge"))
+		steps = append(steps, "age")
+		errs = append(errs, err)
+
+		errs = append(errs, co.Sleep(100*time.Millisecond))
+		steps = append(steps, "slept")
+	})
+
+	// 协程挂起后控制权回到主线程
+	require.Len(t, inner.calls, 1)
+	require.Empty(t, steps)
+
+	inner.calls[0].successCb.(func(string))("snow")
+	inner.resolve(0, nil)
+	require.Equal(t, []string{"name:snow"}, steps)
+	require.Len(t, inner.calls, 2)
+
+	inner.resolve(1, ErrRemoteDisconnected)
+	require.Equal(t, []string{"name:snow", "age"}, steps)
+
+	srv.tw.update(now.Add(50 * time.Millisecond))
+	require.Len(t, steps, 2)
+	srv.tw.update(now.Add(200 * time.Millisecond))
+	require.Equal(t, []string{"name:snow", "age", "slept"}, steps)
+	require.Equal(t, []error{nil, ErrRemoteDisconnected, nil}, errs)
+	require.Empty(t, srv.coroutines)
+}
+
+func TestCoroutineCanceledOnServiceStop(t *testing.T) {
+	srv, _ := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var errs []error
+	srv.Go(func(co Co) {
+		_, err := Await[string](co, inner.Call("GetName"))
+		errs = append(errs, err)
+		errs = append(errs, co.Sleep(time.Second))
+	})
+	require.Len(t, srv.coroutines, 1)
+
+	srv.cancelCoroutines()
+	require.Equal(t, []error{ErrCoroutineCanceled, ErrCoroutineCanceled}, errs)
+	require.Empty(t, srv.coroutines)
+
+	// 取消后返回的结果不再唤醒协程
+	inner.resolve(0, nil)
+
+	canceled := false
+	srv.Go(func(co Co) {
+		canceled = co.Canceled()
+		_, err := Await[string](co, inner.Call("GetName"))
+		errs = append(errs, err)
+	})
+	require.True(t, canceled)
+	require.Len(t, errs, 3)
+	require.Len(t, inner.calls, 1)
+}
+
+func TestCoroutineRecoversPanic(t *testing.T) {
+	srv, _ := newPolicyTestService()
+
+	srv.Go(func(co Co) {
+		panic("boom")
+	})
+	require.Empty(t, srv.coroutines)
+}
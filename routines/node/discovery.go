@@ -0,0 +1,423 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mogud/snow/core/logging/slog"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	registryPathPrefix       = "/node/registry/"
+	registryTokenHeader      = "X-Snow-Registry-Token"
+	defaultRegistryTTL       = 10 * time.Second
+	defaultDiscoveryInterval = 3 * time.Second
+	registryLeaveTimeout     = time.Second
+)
+
+// NodeEntry 注册中心中的节点成员信息
+type NodeEntry struct {
+	Name     string   `json:"name"`
+	Order    int      `json:"order"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	HttpPort int      `json:"httpPort"`
+	Services []string `json:"services"`
+}
+
+// IRegistry 服务发现注册中心
+type IRegistry interface {
+	// Announce 宣告节点成员信息并返回当前全部成员，节点需周期性宣告以保持存活
+	Announce(ctx context.Context, entry *NodeEntry) ([]*NodeEntry, error)
+	// Leave 节点主动离开
+	Leave(ctx context.Context, name string) error
+}
+
+var _ IRegistry = (*MemoryRegistry)(nil)
+var _ IRegistry = (*HttpRegistry)(nil)
+
+// MemoryRegistry 进程内注册中心，超过存活时间未宣告的成员被移除；可作为单机或测试环境的替代，也是节点托管注册中心时的存储，线程安全
+type MemoryRegistry struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]*memoryRegistryEntry
+}
+
+type memoryRegistryEntry struct {
+	entry  *NodeEntry
+	expire time.Time
+}
+
+// NewMemoryRegistry 创建进程内注册中心，ttl 不大于 0 时使用默认值 10 秒
+func NewMemoryRegistry(ttl time.Duration) *MemoryRegistry {
+	if ttl <= 0 {
+		ttl = defaultRegistryTTL
+	}
+	return &MemoryRegistry{
+		ttl:     ttl,
+		entries: make(map[string]*memoryRegistryEntry),
+	}
+}
+
+func (ss *MemoryRegistry) Announce(_ context.Context, entry *NodeEntry) ([]*NodeEntry, error) {
+	if len(entry.Name) == 0 {
+		return nil, fmt.Errorf("empty node name")
+	}
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	now := time.Now()
+	e := *entry
+	ss.entries[e.Name] = &memoryRegistryEntry{entry: &e, expire: now.Add(ss.ttl)}
+
+	list := make([]*NodeEntry, 0, len(ss.entries))
+	for name, v := range ss.entries {
+		if v.expire.Before(now) {
+			delete(ss.entries, name)
+			continue
+		}
+		c := *v.entry
+		list = append(list, &c)
+	}
+	sortNodeEntries(list)
+	return list, nil
+}
+
+func (ss *MemoryRegistry) Leave(_ context.Context, name string) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	delete(ss.entries, name)
+	return nil
+}
+
+// HttpRegistry 通过 Http 访问托管在某个节点上的注册中心，线程安全
+type HttpRegistry struct {
+	announceUrl string
+	leaveUrl    string
+	token       string
+	client      *http.Client
+}
+
+// NewHttpRegistry 创建 Http 注册中心客户端，baseUrl 为托管注册中心节点的 Http 地址，如 http://10.0.0.1:8080；
+// token 为托管方配置的 RegistryToken，托管方未配置时为空
+func NewHttpRegistry(baseUrl, token string) (*HttpRegistry, error) {
+	announceUrl, err := url.JoinPath(baseUrl, registryPathPrefix, "announce")
+	if err != nil {
+		return nil, err
+	}
+	leaveUrl, _ := url.JoinPath(baseUrl, registryPathPrefix, "leave")
+	return &HttpRegistry{
+		announceUrl: announceUrl,
+		leaveUrl:    leaveUrl,
+		token:       token,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+func (ss *HttpRegistry) Announce(ctx context.Context, entry *NodeEntry) ([]*NodeEntry, error) {
+	var list []*NodeEntry
+	if err := ss.post(ctx, ss.announceUrl, entry, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (ss *HttpRegistry) Leave(ctx context.Context, name string) error {
+	return ss.post(ctx, ss.leaveUrl, &NodeEntry{Name: name}, nil)
+}
+
+func (ss *HttpRegistry) post(ctx context.Context, u string, body any, result any) error {
+	bs, err := jsoniter.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(ss.token) > 0 {
+		req.Header.Set(registryTokenHeader, ss.token)
+	}
+
+	rsp, err := ss.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rsp.Body.Close()
+	}()
+
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry response status: %v", rsp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return jsoniter.NewDecoder(rsp.Body).Decode(result)
+}
+
+// tokenMatches 以恒定时间比较令牌，token 为空时不校验
+func tokenMatches(got []byte, token string) bool {
+	return len(token) == 0 || subtle.ConstantTimeCompare(got, []byte(token)) == 1
+}
+
+// serveRegistry 在节点 Http 服务上托管注册中心，token 非空时拒绝未携带相同令牌的请求，须在 Http 服务启动前调用
+func (ss *Node) serveRegistry(r IRegistry, token string) {
+	authorized := func(ctx *fasthttp.RequestCtx) bool {
+		if tokenMatches(ctx.Request.Header.Peek(registryTokenHeader), token) {
+			return true
+		}
+		ctx.Error("invalid registry token", http.StatusUnauthorized)
+		return false
+	}
+
+	ss.handleRequestMethod(registryPathPrefix+"announce", http.MethodPost, func(ctx *fasthttp.RequestCtx) {
+		if !authorized(ctx) {
+			return
+		}
+
+		var entry NodeEntry
+		if err := jsoniter.Unmarshal(ctx.Request.Body(), &entry); err != nil {
+			ctx.Error("invalid node entry", http.StatusBadRequest)
+			return
+		}
+
+		list, err := r.Announce(ctx, &entry)
+		if err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bs, _ := jsoniter.Marshal(list)
+		ctx.SetContentType("application/json")
+		ctx.SetBody(bs)
+	})
+	ss.handleRequestMethod(registryPathPrefix+"leave", http.MethodPost, func(ctx *fasthttp.RequestCtx) {
+		if !authorized(ctx) {
+			return
+		}
+
+		var entry NodeEntry
+		if err := jsoniter.Unmarshal(ctx.Request.Body(), &entry); err != nil {
+			ctx.Error("invalid node entry", http.StatusBadRequest)
+			return
+		}
+
+		_ = r.Leave(ctx, entry.Name)
+	})
+}
+
+func sortNodeEntries(list []*NodeEntry) {
+	slices.SortFunc(list, func(a, b *NodeEntry) int {
+		if a.Order != b.Order {
+			return a.Order - b.Order
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// discovery 周期性向注册中心宣告当前节点并同步成员，供代理按服务名动态查找节点
+type discovery struct {
+	registry IRegistry
+	self     *NodeEntry
+	interval time.Duration
+
+	lock    sync.RWMutex
+	members []*nodeInfo // 不含当前节点，按 Order 排序
+
+	onChanged func() // 成员变化后调用
+}
+
+func newDiscovery(registry IRegistry, self *NodeEntry, interval time.Duration) *discovery {
+	if interval <= 0 {
+		interval = defaultDiscoveryInterval
+	}
+	return &discovery{
+		registry: registry,
+		self:     self,
+		interval: interval,
+	}
+}
+
+// run 宣告并同步成员直到 ctx 结束，结束时主动离开
+func (ss *discovery) run(ctx context.Context) {
+	t := time.NewTicker(ss.interval)
+	defer t.Stop()
+
+	for {
+		ss.announce(ctx)
+
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), registryLeaveTimeout)
+			if err := ss.registry.Leave(leaveCtx, ss.self.Name); err != nil {
+				slog.Warnf("node discovery leave error: %v", err)
+			}
+			cancel()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (ss *discovery) announce(ctx context.Context) {
+	list, err := ss.registry.Announce(ctx, ss.self)
+	if err != nil {
+		// 注册中心不可用时保留上次的成员，由注册中心恢复后更新
+		if ctx.Err() == nil {
+			slog.Warnf("node discovery announce error: %v", err)
+		}
+		return
+	}
+	ss.update(list)
+}
+
+// update 更新成员列表，成员变化时记录日志
+func (ss *discovery) update(list []*NodeEntry) {
+	members := make([]*nodeInfo, 0, len(list))
+	for _, e := range list {
+		if e.Name == ss.self.Name || len(e.Host) == 0 || e.Port <= 0 {
+			continue
+		}
+
+		nAddr, err := NewNodeAddr(e.Host, e.Port)
+		if err != nil {
+			slog.Warnf("node discovery invalid node(%s) address: %v", e.Name, err)
+			continue
+		}
+		members = append(members, &nodeInfo{
+			Name:     e.Name,
+			Order:    e.Order,
+			NodeAddr: nAddr,
+			Host:     e.Host,
+			Port:     e.Port,
+			HttpPort: e.HttpPort,
+			Services: e.Services,
+		})
+	}
+
+	ss.lock.Lock()
+	changed := !slices.EqualFunc(ss.members, members, func(a, b *nodeInfo) bool {
+		return a.Name == b.Name && a.NodeAddr == b.NodeAddr && slices.Equal(a.Services, b.Services)
+	})
+	ss.members = members
+	ss.lock.Unlock()
+
+	if changed {
+		names := make([]string, 0, len(members))
+		for _, m := range members {
+			names = append(names, m.Name)
+		}
+		slog.Infof("node discovery members changed: %v", names)
+		if ss.onChanged != nil {
+			ss.onChanged()
+		}
+	}
+}
+
+// lookup 查找提供服务的节点地址，不存在时返回 AddrInvalid
+func (ss *discovery) lookup(name string) Addr {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	for _, m := range ss.members {
+		if slices.Contains(m.Services, name) {
+			return m.NodeAddr
+		}
+	}
+	return AddrInvalid
+}
+
+// lookupNode 按节点名查找节点地址，不存在时返回 AddrInvalid
+func (ss *discovery) lookupNode(name string) Addr {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	for _, m := range ss.members {
+		if m.Name == name {
+			return m.NodeAddr
+		}
+	}
+	return AddrInvalid
+}
+
+// lookupAll 查找提供服务的全部节点地址，按 Order 排序
+func (ss *discovery) lookupAll(name string) []Addr {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	var addrs []Addr
+	for _, m := range ss.members {
+		if slices.Contains(m.Services, name) {
+			addrs = append(addrs, m.NodeAddr)
+		}
+	}
+	return addrs
+}
+
+// addrs 全部成员的节点地址
+func (ss *discovery) addrs() []Addr {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	addrs := make([]Addr, 0, len(ss.members))
+	for _, m := range ss.members {
+		addrs = append(addrs, m.NodeAddr)
+	}
+	return addrs
+}
+
+// initDiscovery 初始化服务发现，须在 Http 服务启动前调用
+func (ss *Node) initDiscovery() {
+	registry := ss.regOpt.Registry
+	if ss.nodeOpt.RegistryServe {
+		local := NewMemoryRegistry(time.Duration(ss.nodeOpt.RegistryTTLSeconds) * time.Second)
+		if len(ss.nodeOpt.RegistryToken) == 0 {
+			slog.Warnf("node hosted registry has no RegistryToken, anyone reaching the http port can announce or evict nodes")
+		}
+		ss.serveRegistry(local, ss.nodeOpt.RegistryToken)
+		if registry == nil {
+			registry = local
+		}
+	}
+	if registry == nil && len(ss.nodeOpt.RegistryUrl) > 0 {
+		r, err := NewHttpRegistry(ss.nodeOpt.RegistryUrl, ss.nodeOpt.RegistryToken)
+		if err != nil {
+			panic(fmt.Sprintf("node registry url error: %+v", err))
+		}
+		registry = r
+	}
+	if registry == nil {
+		return
+	}
+
+	self := &NodeEntry{
+		Name:     ss.nodeOpt.BootName,
+		Host:     ss.nodeOpt.LocalIP,
+		Port:     Config.CurNodePort,
+		HttpPort: Config.CurNodeHttpPort,
+		Services: Config.CurNodeServices,
+	}
+	if nc, ok := ss.nodeOpt.Nodes[ss.nodeOpt.BootName]; ok {
+		self.Order = nc.Order
+		if len(nc.Host) > 0 {
+			self.Host = nc.Host
+		}
+	}
+	ss.discovery = newDiscovery(registry, self, time.Duration(ss.nodeOpt.AnnounceSeconds)*time.Second)
+	ss.discovery.onChanged = ss.pubsub.onMembersChanged
+}
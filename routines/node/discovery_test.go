@@ -0,0 +1,94 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMemoryRegistryExpiresSilentMembers(t *testing.T) {
+	r := NewMemoryRegistry(50 * time.Millisecond)
+	ctx := context.Background()
+
+	_, err := r.Announce(ctx, &NodeEntry{Name: "b", Order: 2, Host: "127.0.0.1", Port: 2})
+	require.NoError(t, err)
+	list, err := r.Announce(ctx, &NodeEntry{Name: "a", Order: 1, Host: "127.0.0.1", Port: 1})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "a", list[0].Name)
+
+	time.Sleep(60 * time.Millisecond)
+	list, err = r.Announce(ctx, &NodeEntry{Name: "a", Order: 1, Host: "127.0.0.1", Port: 1})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	require.NoError(t, r.Leave(ctx, "a"))
+	list, err = r.Announce(ctx, &NodeEntry{Name: "c", Host: "127.0.0.1", Port: 3})
+	require.NoError(t, err)
+	require.Equal(t, "c", list[0].Name)
+	require.Len(t, list, 1)
+}
+
+func TestHttpRegistryAgainstNodeHostedRegistry(t *testing.T) {
+	hostNode := &Node{nodeOpt: &Option{}, httpHandlers: map[string]fasthttp.RequestHandler{}}
+	hostNode.serveRegistry(NewMemoryRegistry(0), "secret")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = fasthttp.Serve(listener, hostNode.handler) }()
+
+	ctx := context.Background()
+	for _, token := range []string{"", "wrong"} {
+		forged, err := NewHttpRegistry("http://"+listener.Addr().String(), token)
+		require.NoError(t, err)
+		_, err = forged.Announce(ctx, &NodeEntry{Name: "forged", Host: "127.0.0.1", Port: 3})
+		require.ErrorContains(t, err, "401")
+		require.ErrorContains(t, forged.Leave(ctx, "a"), "401")
+	}
+
+	r, err := NewHttpRegistry("http://"+listener.Addr().String(), "secret")
+	require.NoError(t, err)
+
+	_, err = r.Announce(ctx, &NodeEntry{Name: "a", Host: "127.0.0.1", Port: 1, Services: []string{"Ping"}})
+	require.NoError(t, err)
+	list, err := r.Announce(ctx, &NodeEntry{Name: "b", Host: "127.0.0.1", Port: 2})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, []string{"Ping"}, list[0].Services)
+
+	require.NoError(t, r.Leave(ctx, "a"))
+	list, err = r.Announce(ctx, &NodeEntry{Name: "b", Host: "127.0.0.1", Port: 2})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+}
+
+func TestDiscoveryProxyFollowsMembershipChanges(t *testing.T) {
+	r := NewMemoryRegistry(0)
+	d := newDiscovery(r, &NodeEntry{Name: "self", Host: "127.0.0.1", Port: 1, Services: []string{"Pong"}}, 0)
+	proxy := &serviceProxy{sAddr: -1, discovery: d, name: "Pong"}
+
+	// 当前节点不参与查找
+	d.announce(context.Background())
+	require.Equal(t, AddrInvalid, proxy.GetNodeAddr())
+
+	_, err := r.Announce(context.Background(), &NodeEntry{Name: "b", Order: 2, Host: "127.0.0.1", Port: 3, Services: []string{"Pong"}})
+	require.NoError(t, err)
+	d.announce(context.Background())
+	b, _ := NewNodeAddr("127.0.0.1", 3)
+	require.Equal(t, b, proxy.GetNodeAddr())
+
+	_, err = r.Announce(context.Background(), &NodeEntry{Name: "a", Order: 1, Host: "127.0.0.1", Port: 2, Services: []string{"Pong"}})
+	require.NoError(t, err)
+	d.announce(context.Background())
+	a, _ := NewNodeAddr("127.0.0.1", 2)
+	require.Equal(t, a, proxy.GetNodeAddr())
+
+	require.NoError(t, r.Leave(context.Background(), "a"))
+	d.announce(context.Background())
+	require.Equal(t, b, proxy.GetNodeAddr())
+}
@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/mogud/snow/core/logging/slog"
+	net2 "github.com/mogud/snow/core/net"
 	"github.com/mogud/snow/core/task"
 	"github.com/mogud/snow/core/ticker"
 	"io"
+	"math/rand/v2"
 	"net"
 	"strings"
 	"sync"
@@ -20,11 +22,20 @@ var _ iMessageSender = (*remoteHandle)(nil)
 var _ ticker.PoolItem = (*remoteHandle)(nil)
 
 var ErrRemoteDisconnected = fmt.Errorf("remote disconnected")
+var ErrRemoteBufferFull = fmt.Errorf("remote buffer full")
+
+const (
+	defaultReconnectDuration   = 10 * time.Second
+	defaultReconnectBufferSize = 1024
+	reconnectMinBackoff        = 100 * time.Millisecond
+	reconnectMaxBackoff        = 5 * time.Second
+)
 
 type session struct {
 	timeout time.Time
 	cb      func(m *message)
 	trace   int64
+	sent    bool // 请求已写入连接，受 remoteHandle.sendLock 保护
 }
 
 type remoteHandle struct {
@@ -35,23 +46,50 @@ type remoteHandle struct {
 	ctx    context.Context
 	cancel func()
 
+	peerName string // 预处理器认证的对端名称，未认证时为空
+
+	connected atomic.Bool // 连接是否可用，不可用时发送的消息缓存在 wBuffer 中，重连后发送
+	sendLock  sync.Mutex  // 保证消息发出与断线处理互斥
+
+	codec             ICodec
+	compress          bool
+	compressThreshold int
+
 	timeout           int
 	lastSessCheckTime time.Time
 	sessCb            sync.Map // [request_code int]*session;
 	wBuf              chan []byte
 	wBufferLock       sync.Mutex
 	wBuffer           []*message
+	wSpace            *sync.Cond // 发送队列有空间、连接断开或关闭时广播，使用 wBufferLock
 	wg                sync.WaitGroup
 }
 
 func newServerHandle(node *Node, nAddr Addr, conn net.Conn) *remoteHandle {
-	ss := newRemoteHandle(node, nAddr, conn)
-	if err := node.shPreprocessor.Process(conn); err != nil {
+	pConn, peerName, err := net2.Preprocess(node.shPreprocessor, conn)
+	if err != nil {
 		slog.Debugf("illegal remote(%s) connection: %v", conn.RemoteAddr().String(), err)
 		_ = conn.Close()
+		return nil
+	}
+	conn = pConn
+
+	ss := newRemoteHandle(node, nAddr, conn)
+	ss.peerName = peerName
+
+	hs, err := node.serverHandshake(conn)
+	if err != nil {
+		slog.Debugf("remote(%s) handshake failed: %v", conn.RemoteAddr().String(), err)
+		_ = conn.Close()
+		return nil
 	}
+	ss.applyHandshake(hs)
 
-	slog.Infof("node remote(%v) conntected", nAddr)
+	if len(peerName) > 0 {
+		slog.Infof("node remote(%v) peer(%v) conntected", nAddr, peerName)
+	} else {
+		slog.Infof("node remote(%v) conntected", nAddr)
+	}
 	return ss
 }
 
@@ -61,12 +99,23 @@ func newRemoteHandle(node *Node, nAddr Addr, conn net.Conn) *remoteHandle {
 		conn:   conn,
 		nAddr:  nAddr,
 		status: 0,
-		wBuf:   make(chan []byte, 4*1024),
+		wBuf:   make(chan []byte, sendFrameQueueSize),
 	}
+	h.wSpace = sync.NewCond(&h.wBufferLock)
 	h.ctx, h.cancel = context.WithCancel(context.Background())
 	return h
 }
 
+// applyHandshake 应用握手协商结果，须在连接开始收发前调用
+func (ss *remoteHandle) applyHandshake(hs *handshakeResult) {
+	ss.codec = hs.codec
+	ss.compress = hs.compress
+	ss.compressThreshold = defaultCompressThreshold
+	if opt := ss.node.nodeOpt; opt != nil && opt.CompressThreshold > 0 {
+		ss.compressThreshold = opt.CompressThreshold
+	}
+}
+
 func (ss *remoteHandle) Paused() bool {
 	return false
 }
@@ -80,22 +129,26 @@ func (ss *remoteHandle) send(m *message) bool {
 		slog.Debugf("remote handle(%v) closed", ss.nAddr)
 
 		// 关闭时，若有回调，则立即调用
-		if m != nil {
-			if m.cb != nil {
-				em := &message{
-					trace: m.trace,
-					err:   ErrRemoteDisconnected,
-				}
-				m.cb(em)
-			}
-			m.clear()
+		ss.failMessage(m, ErrRemoteDisconnected)
+		return false
+	}
+
+	// 请求与投递受发送队列上限约束，响应及流控制消息数量受限于对端的请求，不做限制
+	if m != nil && m.sess >= 0 && !m.isControl() {
+		if err := ss.reserve(); err != nil {
+			slog.Debugf("remote handle(%v) reject message: %v", ss.nAddr, err)
+			ss.failMessage(m, err)
+			return false
 		}
+	}
 
-		return false
+	// 调用方已放弃的请求或流不再等待响应，流的会话没有超时，须在此移除
+	if m != nil && m.flag&(msgFlagCancel|msgFlagStreamCancel) != 0 {
+		ss.sessCb.Delete(m.sess)
 	}
 
 	// 若是请求，则设置超时回调
-	if m != nil && m.sess > 0 {
+	if m != nil && m.sess > 0 && !m.isControl() {
 		s := &session{
 			cb:    m.cb,
 			trace: m.trace,
@@ -120,32 +173,171 @@ func (ss *remoteHandle) send(m *message) bool {
 	return true
 }
 
-func (ss *remoteHandle) startClient() {
-	ss.start(false)
+func (ss *remoteHandle) failMessage(m *message, err error) {
+	if m == nil {
+		return
+	}
+
+	if m.cb != nil {
+		em := &message{
+			trace: m.trace,
+			err:   err,
+		}
+		m.cb(em)
+	}
+	m.clear()
 }
 
 func (ss *remoteHandle) startServer() {
-	ss.start(true)
+	ss.node.remoteHandleTickerPool.Add(ss)
+	ss.serve(ss.conn, true)
+	ss.safeDelete()
 }
 
-func (ss *remoteHandle) start(isReceiver bool) {
+// runClient 连接发起方的主循环，连接失败或断开后按指数退避重连，持续失败超过重连时长、节点关闭或 updater 解析出其他地址时退出
+func (ss *remoteHandle) runClient(updater *AddrUpdater) {
 	ss.node.remoteHandleTickerPool.Add(ss)
+	defer ss.safeDelete()
+
+	reconnect := ss.reconnectDuration()
+	outage := time.Now()
+	backoff := reconnectMinBackoff
+	for {
+		slog.Infof("node connect to %v...", ss.nAddr)
+		conn, peerName, hs, err := ss.node.dialRemote(ss.nAddr)
+		if err == nil {
+			ss.peerName = peerName
+			ss.applyHandshake(hs)
+			slog.Infof("node connect to %v sucess", ss.nAddr)
+
+			ss.serve(conn, false)
+
+			slog.Infof("node remote(%v) disconnected", ss.nAddr)
+			outage = time.Now()
+			backoff = reconnectMinBackoff
+		} else {
+			slog.Warnf("node connect to %v failed: %v", ss.nAddr, err)
+			if updater != nil {
+				updater.signalRefresh()
+			}
+		}
+
+		if reconnect < 0 || time.Since(outage) >= reconnect {
+			return
+		}
+
+		// 加入随机抖动，避免大量连接同时重连
+		select {
+		case <-ss.ctx.Done():
+			return
+		case <-time.After(backoff + rand.N(backoff/2)):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+
+		// 节点已迁移至新地址，不再重连旧地址，代理随后连接新地址
+		if ss.moved(updater) {
+			slog.Infof("node remote(%v) moved to %v, stop reconnecting", ss.nAddr, updater.GetNodeAddr())
+			return
+		}
+	}
+}
+
+// moved updater 是否已解析出与当前句柄不同的有效地址
+func (ss *remoteHandle) moved(updater *AddrUpdater) bool {
+	if updater == nil {
+		return false
+	}
+	nAddr := updater.GetNodeAddr()
+	return nAddr != AddrInvalid && nAddr != ss.nAddr
+}
+
+// serve 在连接上收发消息，直到连接断开或句柄关闭
+func (ss *remoteHandle) serve(conn net.Conn, isReceiver bool) {
+	ctx, cancel := context.WithCancel(ss.ctx)
+	defer cancel()
+
+	ss.conn = conn
+	ss.timeout = 0
+	ss.connected.Store(true)
+	ss.node.pubsub.onConnected(ss)
 
 	ss.wg.Add(2)
-	task.Execute(ss.doSend)
-	task.Execute(func() { ss.doReceive(isReceiver) })
+	task.Execute(func() { ss.doSend(ctx, cancel, conn) })
+	task.Execute(func() { ss.doReceive(ctx, cancel, conn, isReceiver) })
 
 	ss.wg.Wait()
 
-	_ = ss.conn.Close()
+	_ = conn.Close()
 
-	ss.safeDelete()
+	ss.disconnect()
+}
+
+// disconnect 连接断开后调用，已发出的请求不会再收到响应，立即失败；尚未发出的消息保留到重连后发送
+func (ss *remoteHandle) disconnect() {
+	ss.sendLock.Lock()
+	defer ss.sendLock.Unlock()
+
+	ss.connected.Store(false)
+	ss.wBufferLock.Lock()
+	ss.wSpace.Broadcast()
+	ss.wBufferLock.Unlock()
+
+	for len(ss.wBuf) > 0 {
+		<-ss.wBuf
+	}
+
+	ss.sessCb.Range(func(key, value any) bool {
+		if !value.(*session).sent {
+			return true
+		}
+
+		if value, ok := ss.sessCb.LoadAndDelete(key); ok {
+			v := value.(*session)
+			v.cb(&message{
+				err:   ErrRemoteDisconnected,
+				trace: v.trace,
+			})
+			v.cb = nil
+		}
+		return true
+	})
+}
+
+// reconnectDuration 连接断开后持续重连的最长时间，小于 0 代表不重连
+func (ss *remoteHandle) reconnectDuration() time.Duration {
+	if opt := ss.node.nodeOpt; opt != nil && opt.ReconnectSeconds != 0 {
+		if opt.ReconnectSeconds < 0 {
+			return -1
+		}
+		return time.Duration(opt.ReconnectSeconds) * time.Second
+	}
+	return defaultReconnectDuration
+}
+
+func (ss *remoteHandle) bufferSize() int {
+	if opt := ss.node.nodeOpt; opt != nil && opt.ReconnectBufferSize > 0 {
+		return opt.ReconnectBufferSize
+	}
+	return defaultReconnectBufferSize
 }
 
 func (ss *remoteHandle) safeDelete() {
 	if atomic.CompareAndSwapInt32(&ss.status, 0, 1) {
 		nodeDelRemoteHandle(ss.nAddr)
+		ss.node.pubsub.onHandleClosed(ss.nAddr)
 		ss.closeAllSession()
+
+		ss.wBufferLock.Lock()
+		msgList := ss.wBuffer
+		ss.wBuffer = nil
+		ss.wSpace.Broadcast()
+		ss.wBufferLock.Unlock()
+
+		for _, m := range msgList {
+			if m != nil {
+				m.clear()
+			}
+		}
 	}
 }
 
@@ -192,48 +384,88 @@ func (ss *remoteHandle) onTick() {
 		})
 	}
 
+	if !ss.connected.Load() {
+		return
+	}
+
+	ss.sendLock.Lock()
+	defer ss.sendLock.Unlock()
+
+	if !ss.connected.Load() {
+		return
+	}
+
+	// 上一批次尚未写入连接时不再取出，消息积压在发送队列中形成背压
 	ss.wBufferLock.Lock()
-	msgList := ss.wBuffer
-	ss.wBuffer = nil
+	depth := len(ss.wBuffer)
+	full := len(ss.wBuf) == cap(ss.wBuf)
+	var msgList []*message
+	if !full {
+		msgList = ss.wBuffer
+		ss.wBuffer = nil
+		ss.wSpace.Broadcast()
+	}
 	ss.wBufferLock.Unlock()
 
+	ss.sendQueueDepthMetric(depth)
+
 	if len(msgList) > 0 {
 		buffer := make([]byte, 0, 4*1024)
 		for _, m := range msgList {
-			bs, err := m.marshal()
 			if m != nil {
-				m.clear()
+				if m.sess > 0 && !m.isControl() {
+					v, ok := ss.sessCb.Load(m.sess)
+					if !ok {
+						// 缓存期间已超时
+						m.clear()
+						continue
+					}
+					v.(*session).sent = true
+				}
+				m.codec = ss.codec
 			}
+			bs, err := m.marshal()
 			if err != nil {
+				// 仅放弃无法编码的消息，同批次的其他消息照常发送
 				slog.Errorf("message marshal %v", err.Error())
-				return
+				if m.sess > 0 && !m.isControl() {
+					ss.sessCb.Delete(m.sess)
+				}
+				ss.failMessage(m, err)
+				continue
+			}
+			if m != nil {
+				m.clear()
 			}
 			buffer = append(buffer, bs...)
 		}
 
-		select {
-		case ss.wBuf <- buffer:
-		default:
-			slog.Fatalf("write to remote(%v) while channel full", ss.nAddr)
-			return
+		if ss.compress && len(buffer) >= ss.compressThreshold {
+			if frame := compressFrame(buffer); frame != nil {
+				compressMetric(ss.node.regOpt.MetricCollector, len(buffer), len(frame))
+				buffer = frame
+			}
 		}
+
+		// 仅在此处写入且已确认有空间，不会阻塞
+		ss.wBuf <- buffer
 	}
 }
 
-func (ss *remoteHandle) doSend() {
+func (ss *remoteHandle) doSend(ctx context.Context, cancel func(), conn net.Conn) {
 	defer func() {
-		ss.cancel()
+		cancel()
 		ss.wg.Done()
 	}()
 
 	for {
 		select {
-		case <-ss.ctx.Done():
+		case <-ctx.Done():
 			return
 		case bs := <-ss.wBuf:
-			n, err := ss.conn.Write(bs)
+			n, err := conn.Write(bs)
 			select {
-			case <-ss.ctx.Done():
+			case <-ctx.Done():
 				return
 			default:
 			}
@@ -250,13 +482,12 @@ func (ss *remoteHandle) doSend() {
 	}
 }
 
-func (ss *remoteHandle) doReceive(isReceiver bool) {
+func (ss *remoteHandle) doReceive(ctx context.Context, cancel func(), c net.Conn, isReceiver bool) {
 	var data []byte
 	buf := make([]byte, 4*1024)
-	c := ss.conn
 
 	defer func() {
-		ss.cancel()
+		cancel()
 		ss.wg.Done()
 	}()
 
@@ -264,14 +495,15 @@ func (ss *remoteHandle) doReceive(isReceiver bool) {
 		_ = c.SetReadDeadline(time.Now().Add(1 * time.Second))
 		n, err := c.Read(buf)
 		select {
-		case <-ss.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
 
 		if err != nil {
 			var opErr *net.OpError
-			if errors.As(err, &opErr) && opErr.Timeout() {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
 				if isReceiver {
 					if ss.timeout > 9 {
 						// 发送 ping 消息
@@ -305,7 +537,8 @@ func (ss *remoteHandle) doDivide(data []byte) []byte {
 		if len(data) < 4 {
 			break
 		}
-		msgLen := int(binary.LittleEndian.Uint32(data[:4]))
+		frameLen := binary.LittleEndian.Uint32(data[:4])
+		msgLen := int(frameLen & frameLenMask)
 		if msgLen < 4 {
 			slog.Errorf("net message from %v format error", ss.nAddr)
 			return nil
@@ -313,6 +546,22 @@ func (ss *remoteHandle) doDivide(data []byte) []byte {
 		if len(data) < msgLen {
 			break
 		}
+
+		if frameLen&frameCompressedFlag != 0 {
+			// 压缩帧，解压后的内容为若干条完整的消息
+			raw, err := decompressFrame(data[:msgLen])
+			if err != nil {
+				slog.Errorf("net message from %v decompress error: %v", ss.nAddr, err)
+				return nil
+			}
+			if rest := ss.doDivide(raw); rest == nil || len(rest) > 0 {
+				slog.Errorf("net message from %v compressed frame incomplete", ss.nAddr)
+				return nil
+			}
+
+			data = data[msgLen:]
+			continue
+		}
 		msg := make([]byte, msgLen)
 		copy(msg, data)
 
@@ -326,6 +575,8 @@ func (ss *remoteHandle) doDivide(data []byte) []byte {
 			// dst 不为 0，不是 ping 包，需要处理
 
 			m.nAddr = ss.nAddr
+			m.codec = ss.codec
+			m.peer = ss.peerName
 			ss.doDispatch(m)
 		}
 
@@ -340,7 +591,12 @@ func (ss *remoteHandle) doDispatch(m *message) {
 		// response
 
 		scb, ok := ss.sessCb.Load(-m.sess)
-		if ok {
+		if ok && m.isStreamItem() {
+			// 流中的消息，会话在最终响应到达时结束
+			if cb := scb.(*session).cb; cb != nil {
+				cb(m)
+			}
+		} else if ok {
 			ss.sessCb.Delete(-m.sess)
 
 			cbSess := scb.(*session)
@@ -361,10 +617,19 @@ func (ss *remoteHandle) doDispatch(m *message) {
 		return
 	}
 
+	if m.dst == nodeTopicAddr {
+		// 发布订阅消息由节点处理
+		ss.node.pubsub.onMessage(ss, m)
+		return
+	}
+
 	// request
 	srv := nodeGetService(m.dst)
 	if srv != nil {
 		srv.send(m)
+	} else if m.isControl() {
+		// 流或调用已随服务结束
+		m.clear()
 	} else {
 		slog.Warnf("remote(%v) call service(%d) which not found, message data: %+v", ss.nAddr, m.dst, m)
 		mm := &message{
@@ -0,0 +1,214 @@
+package node
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mogud/snow/core/ticker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteHandleBuffersUntilBoundWhileDisconnected(t *testing.T) {
+	h := newRemoteHandle(&Node{nodeOpt: &Option{ReconnectBufferSize: 2}}, Addr(101), nil)
+
+	var errs []error
+	for sess := int32(1); sess <= 3; sess++ {
+		h.send(newTestRequest(sess, "call", func(m *message) { errs = append(errs, m.err) }))
+	}
+	require.Len(t, h.wBuffer, 2)
+	require.Equal(t, []error{ErrRemoteBufferFull}, errs)
+
+	// 未连接时不发出
+	h.onTick()
+	require.Len(t, h.wBuffer, 2)
+	require.Empty(t, h.wBuf)
+}
+
+func TestRemoteHandleDisconnectFailsOnlySentRequests(t *testing.T) {
+	h := newRemoteHandle(&Node{}, Addr(101), nil)
+	h.applyHandshake(&handshakeResult{codec: JsonCodec})
+	h.connected.Store(true)
+
+	errs := map[int32]error{}
+	h.send(newTestRequest(1, "sent", func(m *message) { errs[1] = m.err }))
+	h.onTick()
+	require.Len(t, h.wBuf, 1)
+
+	h.disconnect()
+	require.Empty(t, h.wBuf)
+	require.Equal(t, map[int32]error{1: ErrRemoteDisconnected}, errs)
+
+	h.send(newTestRequest(2, "buffered", func(m *message) { errs[2] = m.err }))
+	h.disconnect()
+	require.Len(t, errs, 1)
+	require.Equal(t, []string{"buffered"}, requestNames(t, h.wBuffer))
+}
+
+func TestRemoteHandleMarshalErrorFailsOnlyThatMessage(t *testing.T) {
+	h := newRemoteHandle(&Node{}, Addr(101), nil)
+	h.applyHandshake(&handshakeResult{codec: BinaryCodec})
+	h.connected.Store(true)
+
+	errs := map[int32]error{}
+	h.send(newTestRequest(1, "before", func(m *message) { errs[1] = m.err }))
+	bad := &message{src: 1, dst: 2, sess: 2, cb: func(m *message) { errs[2] = m.err }}
+	bad.writeRequest("bad", []any{func() {}})
+	h.send(bad)
+	h.send(newTestRequest(3, "after", func(m *message) { errs[3] = m.err }))
+
+	h.onTick()
+	require.Len(t, h.wBuf, 1)
+	require.Len(t, errs, 1)
+	require.Error(t, errs[2])
+
+	// 无法编码的请求不再等待响应，同批次的请求照常等待
+	_, ok := h.sessCb.Load(int32(2))
+	require.False(t, ok)
+	require.Equal(t, 2, syncMapLen(&h.sessCb))
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() { _, _ = client.Write(<-h.wBuf) }()
+	require.Equal(t, []string{"before", "after"}, readRemoteRequestNames(t, server, 2))
+}
+
+func TestRemoteHandleReconnectsAndReplaysBufferedRequests(t *testing.T) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	nAddr, err := NewNodeAddr("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := ticker.NewPool("test.remote.handle", ctx, &sync.WaitGroup{}, 10, TickInterval)
+	pool.Start(func(item ticker.PoolItem) { item.(*remoteHandle).onTick() }, nil)
+
+	codecMap := map[string]ICodec{JsonCodec.Name(): JsonCodec}
+	gNode = &Node{
+		nodeOpt:                &Option{ReconnectSeconds: 5},
+		regOpt:                 &RegisterOption{},
+		codecs:                 []ICodec{JsonCodec},
+		codecMap:               codecMap,
+		chPreprocessor:         defaultHandlePreprocessor,
+		remoteHandleTickerPool: pool,
+		handle:                 make(map[Addr]*remoteHandle),
+	}
+	serverNode := &Node{nodeOpt: &Option{}, codecs: []ICodec{JsonCodec}, codecMap: codecMap}
+	accept := func() net.Conn {
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		_, err = serverNode.serverHandshake(conn)
+		require.NoError(t, err)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		return conn
+	}
+
+	h := newRemoteHandle(gNode, nAddr, nil)
+	done := make(chan struct{})
+	go func() {
+		h.runClient(nil)
+		close(done)
+	}()
+
+	errs := make(chan error, 2)
+	h.send(newTestRequest(1, "first", func(m *message) { errs <- m.err }))
+	conn := accept()
+	require.Equal(t, []string{"first"}, readRemoteRequestNames(t, conn, 1))
+	_ = conn.Close()
+
+	// 已发出的请求失败，断线期间的请求在重连后发出
+	require.Equal(t, ErrRemoteDisconnected, <-errs)
+	h.send(newTestRequest(2, "second", func(m *message) { errs <- m.err }))
+	conn = accept()
+	require.Equal(t, []string{"second"}, readRemoteRequestNames(t, conn, 1))
+	require.False(t, h.closed())
+
+	h.cancel()
+	<-done
+	_ = conn.Close()
+	require.True(t, h.closed())
+	require.Equal(t, ErrRemoteDisconnected, <-errs)
+}
+
+func TestRemoteHandleFollowsAddrUpdaterDuringOutage(t *testing.T) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	oldAddr, err := NewNodeAddr("127.0.0.1", dead.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, err)
+	_ = dead.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	newAddr, err := NewNodeAddr("127.0.0.1", listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := ticker.NewPool("test.remote.handle", ctx, &sync.WaitGroup{}, 10, TickInterval)
+	pool.Start(func(item ticker.PoolItem) { item.(*remoteHandle).onTick() }, nil)
+
+	codecMap := map[string]ICodec{JsonCodec.Name(): JsonCodec}
+	gNode = &Node{
+		nodeOpt:                &Option{ReconnectSeconds: 60},
+		regOpt:                 &RegisterOption{},
+		codecs:                 []ICodec{JsonCodec},
+		codecMap:               codecMap,
+		chPreprocessor:         defaultHandlePreprocessor,
+		remoteHandleTickerPool: pool,
+		handle:                 make(map[Addr]*remoteHandle),
+		closeWait:              &sync.WaitGroup{},
+	}
+	serverNode := &Node{nodeOpt: &Option{}, codecs: []ICodec{JsonCodec}, codecMap: codecMap}
+
+	updater := NewNodeAddrUpdater(oldAddr, func(context.Context) (Addr, error) { return newAddr, nil })
+	updater.Start(ctx)
+	t.Cleanup(updater.Stop)
+	proxy := &serviceProxy{nAddrUpdater: updater, sAddr: 2}
+
+	// 旧地址连接失败，触发 updater 解析出新地址
+	old := proxy.getSender().(*remoteHandle)
+	errs := make(chan error, 1)
+	old.send(newTestRequest(1, "stale", func(m *message) { errs <- m.err }))
+	require.Eventually(t, func() bool { return updater.GetNodeAddr() == newAddr }, 5*time.Second, 10*time.Millisecond)
+
+	// 代理改用新地址，旧句柄停止重连，缓存的请求立即失败而非等到超时
+	h := proxy.getSender().(*remoteHandle)
+	require.NotSame(t, old, h)
+	require.Equal(t, newAddr, h.nAddr)
+	select {
+	case err := <-errs:
+		require.Equal(t, ErrRemoteDisconnected, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "stale handle still reconnecting")
+	}
+	require.True(t, old.closed())
+
+	h.send(newTestRequest(2, "fresh", func(*message) {}))
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	_, err = serverNode.serverHandshake(conn)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.Equal(t, []string{"fresh"}, readRemoteRequestNames(t, conn, 1))
+
+	h.cancel()
+	gNode.closeWait.Wait()
+}
+
+func newTestRequest(sess int32, fName string, cb func(m *message)) *message {
+	m := &message{src: 1, dst: 2, sess: sess, cb: cb}
+	m.writeRequest(fName, nil)
+	return m
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrRpcHandlerPanic = fmt.Errorf("rpc handler panic")                         // 方法 panic 且尚未响应时响应给调用方的错误
+	ErrRpcBadRequest   = fmt.Errorf("rpc method not found or arguments invalid") // 方法不存在或参数解码失败时响应给调用方的错误
+)
+
+var (
+	rpcContextType = reflect.TypeOf((*IRpcContext)(nil)).Elem()
+	errorType      = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// checkRpcMethod 检查 Rpc 及 HttpRpc 方法的签名，ft 含接收者：
+//
+//	func (ss *S) RpcXxx(ctx IRpcContext, args...)                  // 通过 ctx.Return 或 ctx.Error 响应，可异步
+//	func (ss *S) RpcXxx(ctx IRpcContext, args...) (results..., error) // 同步，返回后自动响应
+//
+// 后者的 error 可省略，存在时须位于末尾
+func checkRpcMethod(ft reflect.Type) error {
+	if ft.NumIn() < 2 || ft.In(1) != rpcContextType {
+		return fmt.Errorf("first parameter must be IRpcContext")
+	}
+	if ft.IsVariadic() {
+		return fmt.Errorf("variadic parameters are not supported")
+	}
+	for i := 0; i < ft.NumOut()-1; i++ {
+		if ft.Out(i) == errorType {
+			return fmt.Errorf("error must be the last result")
+		}
+	}
+	return nil
+}
+
+// callRpcMethod 调用方法，直接返回结果的方法以其结果响应；方法 panic 时以 ErrRpcHandlerPanic 响应，调用方无需等待至超时；
+// 方法中已调用 ctx.Return 或 ctx.Error 时以先响应者为准
+func callRpcMethod(ctx IRpcContext, f reflect.Value, args []reflect.Value) {
+	returned := false
+	defer func() {
+		if !returned {
+			ctx.Error(ErrRpcHandlerPanic)
+		}
+	}()
+	outs := f.Call(args)
+	returned = true
+	if len(outs) > 0 {
+		replyResults(ctx, outs)
+	}
+}
+
+// replyResults 末尾的 error 非空时以其响应错误，否则以其余结果响应
+func replyResults(ctx IRpcContext, outs []reflect.Value) {
+	if n := len(outs); n > 0 && outs[n-1].Type() == errorType {
+		if err, _ := outs[n-1].Interface().(error); err != nil {
+			ctx.Error(err)
+			return
+		}
+		outs = outs[:n-1]
+	}
+
+	args := make([]any, 0, len(outs))
+	for _, out := range outs {
+		args = append(args, out.Interface())
+	}
+	ctx.Return(args...)
+}
@@ -0,0 +1,134 @@
+package node
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type handlerTestUser struct {
+	Name string
+}
+
+var errHandlerTestNotFound = fmt.Errorf("user not found")
+
+type handlerTestService struct {
+	Service
+}
+
+func (ss *handlerTestService) RpcGetUser(ctx IRpcContext, id int64) (*handlerTestUser, error) {
+	if id == 0 {
+		return nil, errHandlerTestNotFound
+	}
+	return &handlerTestUser{Name: fmt.Sprint("user", id)}, nil
+}
+
+func (ss *handlerTestService) RpcSum(ctx IRpcContext, a, b int) int {
+	return a + b
+}
+
+func (ss *handlerTestService) RpcEarly(ctx IRpcContext) (int, error) {
+	ctx.Return(1)
+	return 2, nil
+}
+
+func (ss *handlerTestService) RpcBoom(ctx IRpcContext) error {
+	panic("boom")
+}
+
+func (ss *handlerTestService) RpcVoidBoom(ctx IRpcContext) {
+	panic("boom")
+}
+
+func newHandlerTestPair(t *testing.T) (*Service, *handlerTestService, *serviceProxy) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+	gNode = &Node{}
+
+	caller, _ := newPolicyTestService()
+	caller.sAddr = 1
+
+	callee := &handlerTestService{}
+	callee.node = caller.node
+	callee.logger = testLogger{}
+	callee.tw = caller.tw
+	callee.sAddr = 2
+	callee.realSrv = callee
+	callee.methodMap = map[string]reflect.Value{}
+	st := reflect.TypeOf(callee)
+	for i := 0; i < st.NumMethod(); i++ {
+		m := st.Method(i)
+		if name, ok := strings.CutPrefix(m.Name, "Rpc"); ok {
+			require.NoError(t, checkRpcMethod(m.Type), m.Name)
+			callee.methodMap[name] = m.Func
+		}
+	}
+
+	proxy := &serviceProxy{srv: caller, sAddr: 2, sender: &callee.Service}
+	return caller, callee, proxy
+}
+
+func TestCheckRpcMethod(t *testing.T) {
+	for _, c := range []struct {
+		f  any
+		ok bool
+	}{
+		{func(*Service, IRpcContext) {}, true},
+		{func(*Service, IRpcContext, int) (string, int, error) { return "", 0, nil }, true},
+		{func(*Service, IRpcContext) error { return nil }, true},
+		{func(*Service) {}, false},
+		{func(*Service, int) {}, false},
+		{func(*Service, IRpcContext, ...int) {}, false},
+		{func(*Service, IRpcContext) (error, int) { return nil, 0 }, false},
+	} {
+		err := checkRpcMethod(reflect.TypeOf(c.f))
+		require.Equal(t, c.ok, err == nil, "%T %v", c.f, err)
+	}
+}
+
+func TestRpcHandlerReturnsResults(t *testing.T) {
+	caller, callee, proxy := newHandlerTestPair(t)
+
+	var got []any
+	var errs []error
+	proxy.Call("GetUser", int64(7)).Then(func(u *handlerTestUser) { got = append(got, u.Name) }).Done()
+	proxy.Call("GetUser", int64(0)).Then(func(*handlerTestUser) { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).Done()
+	proxy.Call("Sum", 1, 2).Then(func(v int) { got = append(got, v) }).Done()
+	// 方法中已调用 ctx.Return 时以其为准
+	proxy.Call("Early").Then(func(v int) { got = append(got, v) }).Done()
+
+	callee.onTick()
+	runForked(caller)
+	require.Equal(t, []any{"user7", 3, 1}, got)
+	require.Equal(t, []error{errHandlerTestNotFound}, errs)
+}
+
+func TestRpcHandlerPanicReplies(t *testing.T) {
+	caller, callee, proxy := newHandlerTestPair(t)
+
+	var errs []error
+	proxy.Call("Boom").Then(func() { t.Error("unexpected response") }).
+		Catch(func(err error) { errs = append(errs, err) }).Done()
+
+	callee.onTick()
+	runForked(caller)
+	require.Equal(t, []error{ErrRpcHandlerPanic}, errs)
+}
+
+func TestRpcHandlerFailureUntracksCall(t *testing.T) {
+	caller, callee, proxy := newHandlerTestPair(t)
+
+	var errs []error
+	catch := func(err error) { errs = append(errs, err) }
+	proxy.Call("VoidBoom").Then(func() { t.Error("unexpected response") }).Catch(catch).Done()
+	proxy.Call("Missing").Then(func() { t.Error("unexpected response") }).Catch(catch).Done()
+
+	callee.onTick()
+	runForked(caller)
+	require.Equal(t, []error{ErrRpcHandlerPanic, ErrRpcBadRequest}, errs)
+	require.Empty(t, callee.calls)
+}
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	handshakeTimeout     = 5 * time.Second
+	handshakeMaxFrameLen = 64 * 1024
+)
+
+// protocolVersion 节点间协议版本，消息头等线上格式不兼容的变更须递增，版本不同的节点无法建立连接；
+// 未携带版本的旧节点视为版本 0
+const protocolVersion = 1
+
+// handshakeHello 连接发起方在预处理完成后发送的握手信息
+type handshakeHello struct {
+	Version  int      `json:"Version"`  // 协议版本
+	Codecs   []string `json:"Codecs"`   // 支持的编解码器，按优先级从高到低排列
+	Compress bool     `json:"Compress"` // 是否希望压缩帧
+}
+
+// handshakeReply 连接接收方回复的握手结果
+type handshakeReply struct {
+	Version  int    `json:"Version"`  // 协议版本
+	Codec    string `json:"Codec"`    // 协商得到的编解码器，为空代表协商失败
+	Compress bool   `json:"Compress"` // 双方是否都开启了压缩
+}
+
+// errProtocolVersion 协议版本不一致的错误
+func errProtocolVersion(remote int) error {
+	return fmt.Errorf("handshake: protocol version mismatch, local %d, remote %d; all nodes must run compatible builds", protocolVersion, remote)
+}
+
+// handshakeResult 握手协商的连接参数
+type handshakeResult struct {
+	codec    ICodec
+	compress bool
+}
+
+// clientHandshake 连接发起方握手，返回协商结果
+func (ss *Node) clientHandshake(conn net.Conn) (*handshakeResult, error) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	hello := &handshakeHello{
+		Version:  protocolVersion,
+		Compress: ss.nodeOpt.Compression,
+	}
+	for _, c := range ss.codecs {
+		hello.Codecs = append(hello.Codecs, c.Name())
+	}
+	if err := writeHandshakeFrame(conn, hello); err != nil {
+		return nil, err
+	}
+
+	reply := &handshakeReply{}
+	if err := readHandshakeFrame(conn, reply); err != nil {
+		return nil, err
+	}
+
+	if reply.Version != protocolVersion {
+		return nil, errProtocolVersion(reply.Version)
+	}
+	codec, ok := ss.codecMap[reply.Codec]
+	if !ok {
+		return nil, fmt.Errorf("handshake: codec negotiation failed, remote chose '%v'", reply.Codec)
+	}
+	return &handshakeResult{
+		codec:    codec,
+		compress: reply.Compress && hello.Compress,
+	}, nil
+}
+
+// serverHandshake 连接接收方握手，按发起方的优先级选择双方都支持的编解码器，双方都开启时才压缩
+func (ss *Node) serverHandshake(conn net.Conn) (*handshakeResult, error) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+
+	hello := &handshakeHello{}
+	if err := readHandshakeFrame(conn, hello); err != nil {
+		return nil, err
+	}
+
+	// 版本不一致时不选择编解码器，旧版本的发起方同样会因协商失败断开
+	var codec ICodec
+	if hello.Version == protocolVersion {
+		for _, name := range hello.Codecs {
+			if c, ok := ss.codecMap[name]; ok {
+				codec = c
+				break
+			}
+		}
+	}
+
+	reply := &handshakeReply{
+		Version:  protocolVersion,
+		Compress: hello.Compress && ss.nodeOpt.Compression,
+	}
+	if codec != nil {
+		reply.Codec = codec.Name()
+	}
+	if err := writeHandshakeFrame(conn, reply); err != nil {
+		return nil, err
+	}
+
+	if hello.Version != protocolVersion {
+		return nil, errProtocolVersion(hello.Version)
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("handshake: no common codec in %v", hello.Codecs)
+	}
+	return &handshakeResult{
+		codec:    codec,
+		compress: reply.Compress,
+	}, nil
+}
+
+func writeHandshakeFrame(conn net.Conn, v any) error {
+	bs, err := jsoniter.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+len(bs))
+	binary.LittleEndian.PutUint32(buf, uint32(len(bs)))
+	copy(buf[4:], bs)
+	_, err = conn.Write(buf)
+	return err
+}
+
+func readHandshakeFrame(conn net.Conn, v any) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+
+	l := binary.LittleEndian.Uint32(header)
+	if l > handshakeMaxFrameLen {
+		return fmt.Errorf("handshake: frame length %d exceeds %d", l, handshakeMaxFrameLen)
+	}
+
+	bs := make([]byte, l)
+	if _, err := io.ReadFull(conn, bs); err != nil {
+		return err
+	}
+	return jsoniter.Unmarshal(bs, v)
+}
@@ -8,6 +8,9 @@ type IPromise interface {
 	Final(f func()) IPromise
 	Timeout(timeout time.Duration) IPromise
 	Done()
+	// Cancel 取消调用，须在 Done 之后于服务主线程中调用，以 ErrRequestCanceled 回调 Catch；
+	// 被调用方尚未执行的请求被移除，正在执行的请求可通过 IRpcContext.Canceled 得知，投递无法取消
+	Cancel()
 }
 
 type IProxy interface {
@@ -16,6 +19,12 @@ type IProxy interface {
 	Avail() bool
 }
 
+type IBalancedProxy interface {
+	IProxy
+	// CallWithKey 以 key 作为负载均衡的键调用，供一致性哈希等策略使用
+	CallWithKey(key string, name string, args ...any) IPromise
+}
+
 type ITimeWheelHandle interface {
 	Stop()
 }
@@ -23,9 +32,44 @@ type ITimeWheelHandle interface {
 type IRpcContext interface {
 	GetRemoteNodeAddr() INodeAddr
 	GetRemoteServiceAddr() int32
+	// GetRemotePeerName 获取远端节点经预处理器认证的名称，本地调用或未认证时为空
+	GetRemotePeerName() string
+	// GetTraceID 获取本次调用的调用链追踪 ID
+	GetTraceID() int64
 	Catch(f func(error)) IRpcContext
 	Return(args ...any)
 	Error(error)
+	// Stream 获取流式调用的流，非流式调用返回 nil；Return 或 Error 结束流
+	Stream() IRpcStream
+	// Canceled 调用方是否已取消或超时放弃本次调用，取消后 Return 及 Error 不再发送响应
+	Canceled() bool
+	// Deadline 调用方放弃等待的时刻，由调用方的 Timeout 决定，投递或未设置超时时返回 false；跨节点时依赖节点间的时钟同步
+	Deadline() (time.Time, bool)
+}
+
+type IRpcStream interface {
+	// Send 向调用方发送一条消息；调用方窗口已满时缓存在本地，缓存也满时返回 ErrStreamFull
+	Send(args ...any) error
+	// OnReady 调用方消费使窗口增加且本地缓存已发送完毕时回调，用于继续生产
+	OnReady(f func())
+	// Canceled 调用方是否已取消
+	Canceled() bool
+}
+
+type IStreamPromise interface {
+	// OnNext 收到流中的一条消息时回调，参数同 IPromise.Then
+	OnNext(f any) IStreamPromise
+	// OnComplete 流正常结束时回调
+	OnComplete(f func()) IStreamPromise
+	Catch(f func(error)) IStreamPromise
+	Final(f func()) IStreamPromise
+	// Timeout 空闲超时，超过该时间未收到消息时以 ErrRequestTimeoutLocal 结束并取消流
+	Timeout(timeout time.Duration) IStreamPromise
+	// Window 未确认消息的窗口大小，默认 32
+	Window(n int) IStreamPromise
+	Done()
+	// Cancel 取消流，须在 Done 之后调用，以 ErrStreamCanceled 回调 Catch
+	Cancel()
 }
 
 type INodeAddr interface {
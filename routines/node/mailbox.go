@@ -0,0 +1,82 @@
+package node
+
+import (
+	"fmt"
+)
+
+var ErrMailboxFull = fmt.Errorf("service mailbox full")
+
+// MailboxPolicy 服务邮箱满时的处理策略，被丢弃的请求会以 ErrMailboxFull 返回给调用方
+type MailboxPolicy int
+
+const (
+	MailboxReject     MailboxPolicy = iota // 拒绝新消息
+	MailboxDropOldest                      // 丢弃最早的消息以接收新消息
+	MailboxDropPost                        // 仅丢弃新的投递，请求总是接收
+)
+
+// WithMailbox 设置服务邮箱容量及满时的处理策略，size 不大于 0 代表不限制；Fork 的函数不受限制
+func (ss *ServiceRegisterInfo) WithMailbox(size int, policy MailboxPolicy) *ServiceRegisterInfo {
+	ss.MailboxSize = size
+	ss.MailboxPolicy = policy
+	return ss
+}
+
+// pushMessage 按邮箱策略放入消息，返回被丢弃的消息
+func (ss *Service) pushMessage(msg *message) *message {
+	ss.msgBufferLock.Lock()
+	defer ss.msgBufferLock.Unlock()
+
+	if ss.mailboxSize <= 0 || len(ss.msgBuffer) < ss.mailboxSize {
+		ss.msgBuffer = append(ss.msgBuffer, msg)
+		return nil
+	}
+
+	switch ss.mailboxPolicy {
+	case MailboxDropOldest:
+		dropped := ss.msgBuffer[0]
+		ss.msgBuffer = append(ss.msgBuffer[1:], msg)
+		return dropped
+	case MailboxDropPost:
+		if msg.sess == 0 {
+			return msg
+		}
+		ss.msgBuffer = append(ss.msgBuffer, msg)
+		return nil
+	default:
+		return msg
+	}
+}
+
+// rejectMessage 丢弃消息，若为请求则向调用方返回错误
+func (ss *Service) rejectMessage(m *message, err error) {
+	if mc := ss.node.regOpt.MetricCollector; mc != nil {
+		mc.Counter("[ServiceMailbox] dropped "+ss.name, 1)
+	}
+
+	ss.replyError(m, err)
+	m.clear()
+}
+
+// replyError 若为请求则向调用方返回错误
+func (ss *Service) replyError(m *message, err error) {
+	if m.sess > 0 {
+		mRsp := &message{
+			nAddr: m.nAddr,
+			src:   0,
+			dst:   m.src,
+			sess:  -m.sess,
+			trace: m.trace,
+			err:   err,
+		}
+		if m.cb != nil {
+			m.cb(mRsp)
+		} else if m.nAddr != 0 {
+			if sender := nodeGetMessageSender(m.nAddr, m.src, false, nil); sender != nil {
+				sender.send(mRsp)
+			} else {
+				mRsp.clear()
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMailboxTestService(policy MailboxPolicy) (*Service, *testMetricCollector) {
+	mc := &testMetricCollector{gauges: map[string]int64{}, counters: map[string]uint64{}}
+	return &Service{
+		node:          &Node{regOpt: &RegisterOption{MetricCollector: mc}},
+		name:          "Test",
+		mailboxSize:   2,
+		mailboxPolicy: policy,
+	}, mc
+}
+
+func TestMailboxRejectFailsNewRequest(t *testing.T) {
+	srv, mc := newMailboxTestService(MailboxReject)
+
+	var errs []error
+	cb := func(m *message) { errs = append(errs, m.getError()) }
+	require.True(t, srv.send(newTestPost("first")))
+	require.True(t, srv.send(newTestRequest(1, "second", cb)))
+	require.False(t, srv.send(newTestRequest(2, "third", cb)))
+	require.False(t, srv.send(newTestPost("fourth")))
+
+	require.Equal(t, []error{ErrMailboxFull}, errs)
+	require.Equal(t, []string{"first", "second"}, requestNames(t, srv.msgBuffer))
+	require.Equal(t, uint64(2), mc.counters["[ServiceMailbox] dropped Test"])
+}
+
+func TestMailboxDropOldestFailsDroppedRequest(t *testing.T) {
+	srv, _ := newMailboxTestService(MailboxDropOldest)
+
+	var errs []error
+	require.True(t, srv.send(newTestRequest(1, "first", func(m *message) { errs = append(errs, m.getError()) })))
+	require.True(t, srv.send(newTestPost("second")))
+	require.True(t, srv.send(newTestPost("third")))
+
+	require.Equal(t, []error{ErrMailboxFull}, errs)
+	require.Equal(t, []string{"second", "third"}, requestNames(t, srv.msgBuffer))
+}
+
+func TestMailboxDropPostKeepsRequests(t *testing.T) {
+	srv, _ := newMailboxTestService(MailboxDropPost)
+
+	require.True(t, srv.send(newTestPost("first")))
+	require.True(t, srv.send(newTestPost("second")))
+	require.False(t, srv.send(newTestPost("third")))
+	require.True(t, srv.send(newTestRequest(1, "request", nil)))
+
+	require.Equal(t, []string{"first", "second", "request"}, requestNames(t, srv.msgBuffer))
+}
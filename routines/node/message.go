@@ -5,11 +5,23 @@ import (
 	"fmt"
 	"reflect"
 	"time"
-
-	jsoniter "github.com/json-iterator/go"
 )
 
-const messageHeaderLen = 24
+const messageHeaderLen = 36
+
+// 消息头中的标志位，与窗口共用 4 字节：低 8 位为标志，高 24 位为窗口
+const (
+	msgFlagStream       = 1 << 0 // 请求：流式调用；响应：流中的一条消息，非最终响应
+	msgFlagStreamAck    = 1 << 1 // 控制：调用方消费后增加窗口
+	msgFlagStreamCancel = 1 << 2 // 控制：调用方取消流
+	msgFlagPublish      = 1 << 3 // 节点间：发布至主题的消息
+	msgFlagInterest     = 1 << 4 // 节点间：节点的全部订阅模式
+	msgFlagCancel       = 1 << 5 // 控制：调用方取消请求
+
+	msgFlagMask       = 0xff
+	msgFlagCreditBits = 8
+	msgMaxCredit      = 1<<24 - 1
+)
 
 type iMessageSender interface {
 	send(msg *message) bool
@@ -17,26 +29,42 @@ type iMessageSender interface {
 }
 
 type message struct {
-	nAddr   Addr             // do not marshal
-	cb      func(m *message) // do not marshal, used by inner node rpc
-	timeout time.Duration    // do not marshal
-	src     int32            // 0 if error occurs
-	dst     int32            // kind or address, 0 if is ping package
-	sess    int32            // req: > 0, post: == 0, resp: < 0
-	trace   int64            // trace id
-	err     error            // ok: nil
-	fName   string           // req: len() > 0; resp: len() == 0
-	args    []reflect.Value  // not nil: request
-	data    []byte           // remote call: not nil; local call: nil(marshal not needed)
+	nAddr    Addr             // do not marshal
+	cb       func(m *message) // do not marshal, used by inner node rpc
+	timeout  time.Duration    // do not marshal
+	codec    ICodec           // do not marshal, remote call only, nil means default codec
+	peer     string           // do not marshal, authenticated remote peer name
+	src      int32            // 0 if error occurs
+	dst      int32            // kind or address, 0 if is ping package
+	sess     int32            // req: > 0, post: == 0, resp: < 0
+	trace    int64            // trace id
+	flag     uint8            // msgFlag*
+	credit   int32            // stream request: initial window; ack: window increment
+	deadline int64            // req: caller gives up at this time in unix nano, 0 means no deadline
+	err      error            // ok: nil
+	fName    string           // req: len() > 0; resp: len() == 0
+	args     []reflect.Value  // not nil: request
+	data     []byte           // remote call: not nil; local call: nil(marshal not needed)
+}
+
+func (ss *message) getCodec() ICodec {
+	if ss.codec == nil {
+		return defaultCodec
+	}
+	return ss.codec
 }
 
 func (ss *message) marshalArgs(args []reflect.Value) ([]byte, error) {
 	mArgs := make([]any, 0, len(args))
 	for _, arg := range args {
-		mArgs = append(mArgs, arg.Interface())
+		if arg.IsValid() {
+			mArgs = append(mArgs, arg.Interface())
+		} else {
+			mArgs = append(mArgs, nil)
+		}
 	}
 
-	bs, err := jsoniter.ConfigDefault.Marshal(mArgs)
+	bs, err := ss.getCodec().Marshal(mArgs)
 	if err != nil {
 		return nil, err
 	}
@@ -48,13 +76,13 @@ func (ss *message) unmarshalArgs(bs []byte, argI int, ft reflect.Type) ([]reflec
 	for i := argI; i < ft.NumIn(); i++ {
 		tArgs = append(tArgs, reflect.New(ft.In(i)).Interface())
 	}
-	if err := jsoniter.ConfigDefault.Unmarshal(bs, &tArgs); err != nil {
+	if err := ss.getCodec().Unmarshal(bs, tArgs); err != nil {
 		return nil, err
 	}
 	ret := make([]reflect.Value, 0, len(tArgs))
 	for i, arg := range tArgs {
 		if arg == nil {
-			ret = append(ret, reflect.Zero(ft.In(i)))
+			ret = append(ret, reflect.Zero(ft.In(argI+i)))
 		} else {
 			ret = append(ret, reflect.ValueOf(arg).Elem())
 		}
@@ -92,6 +120,8 @@ func (ss *message) marshal() ([]byte, error) {
 		binary.LittleEndian.PutUint16(ss.data[messageHeaderLen:], uint16(2+lof))
 		copy(ss.data[messageHeaderLen+2:], ss.fName)
 		copy(ss.data[messageHeaderLen+2+lof:], bs)
+	} else if ss.isControl() { // control
+		ss.data = make([]byte, messageHeaderLen)
 	} else if ss.args != nil { // response
 		// 没有 fName 但存在 args，即为 response
 
@@ -113,6 +143,8 @@ func (ss *message) marshal() ([]byte, error) {
 	binary.LittleEndian.PutUint32(ss.data[8:12], uint32(ss.dst))
 	binary.LittleEndian.PutUint32(ss.data[12:16], uint32(ss.sess))
 	binary.LittleEndian.PutUint64(ss.data[16:24], uint64(ss.trace))
+	binary.LittleEndian.PutUint32(ss.data[24:28], uint32(ss.flag)|uint32(ss.credit)<<msgFlagCreditBits)
+	binary.LittleEndian.PutUint64(ss.data[28:36], uint64(ss.deadline))
 	return ss.data, nil
 }
 
@@ -133,14 +165,29 @@ func (ss *message) unmarshal(bytes []byte) error {
 	dst := int32(binary.LittleEndian.Uint32(bytes[8:12]))
 	sess := int32(binary.LittleEndian.Uint32(bytes[12:16]))
 	trace := int64(binary.LittleEndian.Uint64(bytes[16:24]))
+	flag := binary.LittleEndian.Uint32(bytes[24:28])
+	deadline := int64(binary.LittleEndian.Uint64(bytes[28:36]))
 	ss.src = src
 	ss.dst = dst
 	ss.sess = sess
 	ss.trace = trace
+	ss.flag = uint8(flag & msgFlagMask)
+	ss.credit = int32(flag >> msgFlagCreditBits)
+	ss.deadline = deadline
 	ss.data = bytes
 	return nil
 }
 
+// isControl 是否为流控制或取消消息，控制消息不建立会话，也不进入服务邮箱
+func (ss *message) isControl() bool {
+	return ss.flag&(msgFlagStreamAck|msgFlagStreamCancel|msgFlagCancel) != 0
+}
+
+// isStreamItem 是否为流中的一条非最终响应
+func (ss *message) isStreamItem() bool {
+	return ss.sess < 0 && ss.flag&msgFlagStream != 0
+}
+
 func (ss *message) getError() error {
 	if ss.err != nil {
 		return ss.err
@@ -229,6 +276,7 @@ func (ss *message) getResponse(ft reflect.Type) ([]reflect.Value, error) {
 
 func (ss *message) clear() {
 	ss.cb = nil
+	ss.codec = nil
 	ss.args = nil
 	ss.data = nil
 }
@@ -2,6 +2,7 @@ package node
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"math"
@@ -52,6 +53,22 @@ type Option struct {
 	HttpTimeoutSeconds   int                       `snow:"HttpTimeoutSeconds"`   // 节点 Http 服务超时时间
 	HttpDebug            bool                      `snow:"HttpDebug"`            // 节点 Http 是否为调试模式
 	BootName             string                    `snow:"BootName"`             // 启动节点名
+	Compression          bool                      `snow:"Compression"`          // 节点间 Tcp 连接是否压缩，连接双方都开启时生效
+	CompressThreshold    int                       `snow:"CompressThreshold"`    // 压缩阈值字节数，单次发送的数据小于该值时不压缩，默认 1024
+	TlsCertFile          string                    `snow:"TlsCertFile"`          // 节点 Tcp 连接的证书文件，与 TlsKeyFile 同时为空代表不启用 TLS；文件修改后自动重新加载
+	TlsKeyFile           string                    `snow:"TlsKeyFile"`           // 节点 Tcp 连接的私钥文件
+	TlsCAFile            string                    `snow:"TlsCAFile"`            // 校验对端证书的 CA 文件，为空使用系统根证书
+	TlsServerName        string                    `snow:"TlsServerName"`        // 校验服务端证书使用的名称，为空使用所连接节点的主机地址
+	TlsClientAuth        bool                      `snow:"TlsClientAuth"`        // 是否启用双向认证，启用后连接发起方需出示证书
+	ReconnectSeconds     int                       `snow:"ReconnectSeconds"`     // 连接断开后持续重连的最长时间，超过后缓存的调用失败，默认 10，小于 0 代表不重连
+	ReconnectBufferSize  int                       `snow:"ReconnectBufferSize"`  // 连接建立前或重连期间缓存的最大消息数，超过后新的调用立即失败，默认 1024
+	SendQueueSize        int                       `snow:"SendQueueSize"`        // 每个远端连接待发送的最大消息数，默认 8192
+	SendQueuePolicy      string                    `snow:"SendQueuePolicy"`      // 发送队列满时的策略：Fail 调用立即失败，Drop 丢弃最早的投递腾出空间，Block 阻塞调用方服务；默认 Fail
+	RegistryUrl          string                    `snow:"RegistryUrl"`          // 注册中心地址，即托管注册中心节点的 Http 地址；为空且未托管、未注册 Registry 时不启用服务发现
+	RegistryServe        bool                      `snow:"RegistryServe"`        // 当前节点是否在 Http 服务上托管注册中心
+	RegistryToken        string                    `snow:"RegistryToken"`        // 托管及访问注册中心、调用节点管理服务的共享令牌，须在全部节点上一致；为空时不校验，Http 端口及节点端口不得暴露于不可信网络
+	RegistryTTLSeconds   int                       `snow:"RegistryTTLSeconds"`   // 托管的注册中心中成员未宣告的最长存活时间，默认 10
+	AnnounceSeconds      int                       `snow:"AnnounceSeconds"`      // 向注册中心宣告当前节点并同步成员的间隔，默认 3
 	Nodes                map[string]*ElementOption `snow:"Nodes"`                // 当前关注的节点信息
 }
 
@@ -61,12 +78,18 @@ type RegisterOption struct {
 	ServerHandlePreprocessor net2.IPreprocessor
 	PostInitializer          func()
 	MetricCollector          IMetricCollector
+	SpanExporter             ISpanExporter // 调用链 Span 导出器，为空代表不导出
+	Codecs                   []ICodec      // 远端 RPC 参数编解码器，按优先级从高到低排列，与远端协商使用；JsonCodec 总是作为保底
+	Registry                 IRegistry     // 服务发现注册中心，优先于 Option.RegistryUrl；Nodes 配置中找不到的服务通过注册中心动态查找
 }
 
 type ServiceRegisterInfo struct {
-	Kind int32
-	Name string
-	Type reflect.Type
+	Kind          int32
+	Name          string
+	Type          reflect.Type
+	MailboxSize   int               // 服务邮箱容量，即单帧内待处理的最大消息数，不大于 0 代表不限制
+	MailboxPolicy MailboxPolicy     // 服务邮箱满时的处理策略
+	Supervisor    *SupervisorOption // 服务的监督策略，为空代表崩溃后不重启
 }
 
 type consService[T any] interface {
@@ -122,6 +145,8 @@ type Node struct {
 	nodeScope      injection.IRoutineScope
 	chPreprocessor net2.IPreprocessor
 	shPreprocessor net2.IPreprocessor
+	codecs         []ICodec
+	codecMap       map[string]ICodec
 	kind2Info      map[int32]*ServiceRegisterInfo
 	name2Info      map[string]*ServiceRegisterInfo
 	name2Addr      map[string]int32
@@ -138,6 +163,12 @@ type Node struct {
 
 	tcpListener  net.Listener
 	httpListener net.Listener
+	tls          *tlsReloader
+
+	sendQueuePolicy sendQueuePolicy
+	discovery       *discovery
+	pubsub          *pubsub
+	supervisor      *supervisor
 
 	ctx    context.Context
 	cancel func()
@@ -166,6 +197,15 @@ func (ss *Node) Construct(host host.IHost, logger *logging.Logger[Node], nodeOpt
 		ss.shPreprocessor = defaultHandlePreprocessor
 	}
 
+	ss.codecMap = make(map[string]ICodec)
+	for _, c := range append(ss.regOpt.Codecs, JsonCodec) {
+		if _, ok := ss.codecMap[c.Name()]; ok {
+			continue
+		}
+		ss.codecMap[c.Name()] = c
+		ss.codecs = append(ss.codecs, c)
+	}
+
 	ss.kind2Info = make(map[int32]*ServiceRegisterInfo)
 	ss.name2Info = make(map[string]*ServiceRegisterInfo)
 	ss.name2Addr = make(map[string]int32)
@@ -177,6 +217,8 @@ func (ss *Node) Construct(host host.IHost, logger *logging.Logger[Node], nodeOpt
 	ss.services = make(map[int32]*Service)
 	ss.handle = make(map[Addr]*remoteHandle) // node address: handle
 	ss.httpHandlers = make(map[string]fasthttp.RequestHandler)
+	ss.pubsub = newPubSub(ss)
+	ss.supervisor = newSupervisor(ss, host.GetRoutineProvider())
 
 	ss.ctx, ss.cancel = context.WithCancel(context.Background())
 
@@ -224,7 +266,7 @@ func (ss *Node) Construct(host host.IHost, logger *logging.Logger[Node], nodeOpt
 		}
 	}
 
-	srvInfos := ss.regOpt.ServiceRegisterInfos
+	srvInfos := append([]*ServiceRegisterInfo{nodeManagerRegisterInfo()}, ss.regOpt.ServiceRegisterInfos...)
 	for _, info := range srvInfos {
 		kind, st, name := info.Kind, info.Type, info.Name
 
@@ -250,6 +292,10 @@ func (ss *Node) Construct(host host.IHost, logger *logging.Logger[Node], nodeOpt
 		for i := 0; i < st.NumMethod(); i++ {
 			m := st.Method(i)
 			if strings.HasPrefix(m.Name, "Rpc") {
+				if err := checkRpcMethod(m.Type); err != nil {
+					ss.logger.Errorf("service (%s) method %s ignored: %v", name, m.Name, err)
+					continue
+				}
 				methods[strings.TrimPrefix(m.Name, "Rpc")] = m.Func
 			}
 		}
@@ -258,6 +304,10 @@ func (ss *Node) Construct(host host.IHost, logger *logging.Logger[Node], nodeOpt
 		for i := 0; i < st.NumMethod(); i++ {
 			m := st.Method(i)
 			if strings.HasPrefix(m.Name, "HttpRpc") {
+				if err := checkRpcMethod(m.Type); err != nil {
+					ss.logger.Errorf("service (%s) method %s ignored: %v", name, m.Name, err)
+					continue
+				}
 				httpMethods[strings.TrimPrefix(m.Name, "HttpRpc")] = m.Func
 			}
 		}
@@ -298,8 +348,20 @@ func (ss *Node) Start(ctx context.Context, wg *sync2.TimeoutWaitGroup) {
 		Second int32
 	}
 	var services []*servicePair
+
+	// 节点管理服务先于其他服务启动
+	managerAddr, err := newService(nodeManagerName, true)
+	if err != nil {
+		ss.logger.Fatalf("create service(%s) error: %+v", nodeManagerName, err)
+	}
+	ss.name2Addr[nodeManagerName] = managerAddr
+	services = append(services, &servicePair{
+		First:  nodeManagerName,
+		Second: managerAddr,
+	})
+
 	for _, sn := range Config.CurNodeServices {
-		sAddr, err := newService(sn)
+		sAddr, err := newService(sn, true)
 		if err != nil {
 			ss.logger.Fatalf("create service(%s) error: %+v", sn, err)
 		}
@@ -309,13 +371,29 @@ func (ss *Node) Start(ctx context.Context, wg *sync2.TimeoutWaitGroup) {
 			Second: sAddr,
 		})
 
-		s := nodeGetService(sAddr)
+		// 服务被监督者重启后地址变化，按服务名查找当前实例
 		path, _ := url.JoinPath(httpRpcPathPrefix, sn)
-		ss.handleRequestMethod(path, http.MethodPost, s.handleHttpRpc)
+		ss.handleRequestMethod(path, http.MethodPost, func(ctx *fasthttp.RequestCtx) {
+			if s := nodeGetService(ss.configuredAddr(sn)); s != nil {
+				s.handleHttpRpc(ctx)
+			}
+		})
 	}
 
+	ss.initDiscovery()
 	ss.postInitOptions()
 
+	if ss.discovery != nil {
+		ss.closeWait.Add(1)
+		task.Execute(func() {
+			defer ss.closeWait.Done()
+			ss.discovery.run(ss.ctx)
+		})
+	}
+
+	// 服务启动前与其他节点建立连接并交换订阅，服务启动后的发布可投递至远程订阅者
+	ss.pubsub.announce()
+
 	task.Execute(func() {
 		for _, service := range services {
 			sn, sAddr := service.First, service.Second
@@ -369,10 +447,15 @@ func (ss *Node) startProfileInterface() {
 func (ss *Node) Stop(ctx context.Context, wg *sync2.TimeoutWaitGroup) {
 	wg.Add(1)
 	ss.cancel()
+	ss.supervisor.stop()
 
+	// 节点管理服务最先关闭，其创建的服务随之关闭
+	stopNames := []string{nodeManagerName}
 	for i := len(Config.CurNodeServices) - 1; i >= 0; i-- {
-		sn := Config.CurNodeServices[i]
-		if addr, ok := ss.name2Addr[sn]; ok {
+		stopNames = append(stopNames, Config.CurNodeServices[i])
+	}
+	for _, sn := range stopNames {
+		if addr := ss.configuredAddr(sn); addr != 0 {
 			swg := &sync.WaitGroup{}
 			swg.Add(1)
 			task.Execute(func() {
@@ -439,6 +522,16 @@ func (ss *Node) nodeStartListen() {
 		}
 
 		task.Execute(func() {
+			if ss.tls != nil {
+				tc := tls.Server(conn, ss.tls.serverConfig())
+				if err := tlsHandshake(tc); err != nil {
+					slog.Warnf("node remote(%v) tls handshake failed: %v", nAddr, err)
+					_ = conn.Close()
+					return
+				}
+				conn = tc
+			}
+
 			h := newServerHandle(ss, nAddr, conn)
 			if h == nil {
 				return
@@ -468,10 +561,11 @@ func (ss *Node) nodeAddRemoteHandle(nAddr Addr, h *remoteHandle) {
 var gNode *Node
 
 func NewService(name string) (int32, error) {
-	return newService(name)
+	return newService(name, true)
 }
 
-func newService(name string) (int32, error) {
+// newService 创建服务实例，alias 为真时同时作为该类服务按服务名寻址的实例
+func newService(name string, alias bool) (int32, error) {
 	info := gNode.name2Info[name]
 	if info == nil {
 		return 0, fmt.Errorf("service proto kind(%s) is not registered", name)
@@ -489,18 +583,28 @@ func newService(name string) (int32, error) {
 	nss := nsi.(iService)
 	ns := nss.getService()
 	ns.init(gNode, name, kind, gNode.sAddr, nss, gNode.methodMap[kind], gNode.httpMethodMap[kind])
+	ns.mailboxSize = info.MailboxSize
+	ns.mailboxPolicy = info.MailboxPolicy
+	ns.supervisor = info.Supervisor
 
 	host.Inject(gNode.nodeScope, nsi)
 
 	ns.afterInject()
 
 	gNode.services[gNode.sAddr] = ns
-	gNode.services[-kind] = ns
+	if alias {
+		gNode.services[-kind] = ns
+	}
 	return gNode.sAddr, nil
 }
 
 // StartService 快速启动一个服务，保证异步调用到 Service 的 Start，由用户保证完整、正确启动
 func StartService(sAddr int32, arg any) bool {
+	return startService(sAddr, arg, nil)
+}
+
+// startService 启动服务，done 非空时以 Start 的结果回调
+func startService(sAddr int32, arg any, done func(error)) bool {
 	gNode.Lock()
 	defer gNode.Unlock()
 
@@ -509,7 +613,7 @@ func StartService(sAddr int32, arg any) bool {
 		return false
 	}
 
-	srv.start(arg)
+	srv.start(arg, done)
 
 	return true
 }
@@ -531,6 +635,37 @@ func StopService(sAddr int32) bool {
 	return true
 }
 
+// dialRemote 连接远端节点并完成 TLS、预处理及握手，返回可直接收发的连接
+func (ss *Node) dialRemote(nAddr Addr) (net.Conn, string, *handshakeResult, error) {
+	conn, err := net.Dial("tcp", nAddr.String())
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if ss.tls != nil {
+		tc := tls.Client(conn, ss.tls.clientConfig(nAddr.String()))
+		if err = tlsHandshake(tc); err != nil {
+			_ = conn.Close()
+			return nil, "", nil, fmt.Errorf("tls handshake: %w", err)
+		}
+		conn = tc
+	}
+
+	pConn, peerName, err := net2.Preprocess(ss.chPreprocessor, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, "", nil, fmt.Errorf("send identity: %w", err)
+	}
+	conn = pConn
+
+	hs, err := ss.clientHandshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, "", nil, fmt.Errorf("handshake: %w", err)
+	}
+	return conn, peerName, hs, nil
+}
+
 func nodeGenSessionID() int32 {
 	atomic.CompareAndSwapInt32(&gNode.sessID, math.MaxInt32, 0) // 保证+1之后不会出现负数。否则rpc会一直有问题
 	return atomic.AddInt32(&gNode.sessID, 1)
@@ -550,10 +685,10 @@ func nodeDelRemoteHandle(nAddr Addr) {
 	delete(gNode.handle, nAddr)
 }
 
-func nodeGetMessageSender(nAddr Addr, sAddr int32, retry bool, retrySignal func()) iMessageSender {
+func nodeGetMessageSender(nAddr Addr, sAddr int32, retry bool, updater *AddrUpdater) iMessageSender {
 	if nAddr == AddrInvalid {
-		if retry && retrySignal != nil {
-			retrySignal()
+		if retry && updater != nil {
+			updater.signalRefresh()
 		}
 		return nil
 	}
@@ -578,33 +713,9 @@ func nodeGetMessageSender(nAddr Addr, sAddr int32, retry bool, retrySignal func(
 	gNode.handle[nAddr] = h
 
 	task.Execute(func() {
-		slog.Infof("node connect to %v...", nAddr)
-		conn, err := net.Dial("tcp4", nAddr.String())
-		if err != nil {
-			slog.Warnf("node get remote handle failed: %+v", err)
-			h.safeDelete()
-			if retrySignal != nil {
-				retrySignal()
-			}
-			return
-		}
-
-		h.conn = conn
-
-		if err = gNode.chPreprocessor.Process(conn); err != nil {
-			slog.Warnf("send identity to server(%v) failed: %v", nAddr, err)
-			h.safeDelete()
-			_ = conn.Close()
-			if retrySignal != nil {
-				retrySignal()
-			}
-			return
-		}
-
 		gNode.closeWait.Add(1)
 		defer gNode.closeWait.Done()
-		slog.Infof("node connect to %v sucess", nAddr)
-		h.startClient()
+		h.runClient(updater)
 	})
 	return h
 }
@@ -0,0 +1,90 @@
+package node
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newPauseTestService() (*Service, *testMetricCollector) {
+	mc := &testMetricCollector{gauges: map[string]int64{}, counters: map[string]uint64{}}
+	return &Service{
+		node:          &Node{regOpt: &RegisterOption{MetricCollector: mc}},
+		name:          "Test",
+		logger:        testLogger{},
+		tw:            newTimeWheel(time.Now(), 10*time.Millisecond),
+		mailboxSize:   2,
+		mailboxPolicy: MailboxReject,
+	}, mc
+}
+
+func TestPauseResume(t *testing.T) {
+	srv, mc := newPauseTestService()
+
+	require.False(t, srv.Paused())
+	require.False(t, srv.Resume())
+
+	require.True(t, srv.Pause())
+	require.True(t, srv.Paused())
+	require.False(t, srv.Pause())
+	require.Equal(t, int64(1), mc.gauges["[ServicePaused] Test"])
+
+	require.True(t, srv.Resume())
+	require.False(t, srv.Paused())
+	require.False(t, srv.Resume())
+	require.Equal(t, int64(0), mc.gauges["[ServicePaused] Test"])
+	require.Equal(t, []string{"[ServicePausedDuration] Test"}, mc.histograms)
+}
+
+func TestPauseDefersRemainingWork(t *testing.T) {
+	srv, _ := newPauseTestService()
+
+	var ran []string
+	srv.Fork("first", func() {
+		ran = append(ran, "first")
+		srv.Pause()
+	})
+	srv.Fork("second", func() { ran = append(ran, "second") })
+	require.True(t, srv.send(newTestPost("post")))
+
+	srv.onTick()
+	require.Equal(t, []string{"first"}, ran)
+	require.Len(t, srv.funcBuffer, 1)
+	require.Equal(t, []string{"post"}, requestNames(t, srv.msgBuffer))
+
+	// 暂停期间 Fork 的函数排在推迟的函数之后
+	srv.Fork("third", func() { ran = append(ran, "third") })
+	srv.onTick()
+	require.Equal(t, []string{"first"}, ran)
+
+	srv.msgBuffer = nil
+	require.True(t, srv.Resume())
+	srv.onTick()
+	require.Equal(t, []string{"first", "second", "third"}, ran)
+}
+
+func TestPausedMailboxKeepsBound(t *testing.T) {
+	srv, _ := newPauseTestService()
+	require.True(t, srv.Pause())
+
+	var errs []error
+	cb := func(m *message) { errs = append(errs, m.getError()) }
+	require.True(t, srv.send(newTestPost("first")))
+	require.True(t, srv.send(newTestRequest(1, "second", cb)))
+	require.False(t, srv.send(newTestRequest(2, "third", cb)))
+
+	srv.onTick()
+	require.Equal(t, []error{ErrMailboxFull}, errs)
+	require.Equal(t, []string{"first", "second"}, requestNames(t, srv.msgBuffer))
+}
+
+func TestPauseAfterStopFails(t *testing.T) {
+	srv, mc := newPauseTestService()
+	atomic.StoreInt32(&srv.closedLock, 1)
+
+	require.False(t, srv.Pause())
+	require.False(t, srv.Paused())
+	require.NotContains(t, mc.gauges, "[ServicePaused] Test")
+}
@@ -0,0 +1,303 @@
+package node
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// CallPolicy 代理调用策略，零值字段使用默认值
+//
+// 重试及对冲仅作用于幂等方法的请求，投递只应用默认超时；每次尝试单独计算超时
+type CallPolicy struct {
+	Timeout         time.Duration           // 未通过 IPromise.Timeout 指定时的超时时间，不大于 0 时使用代理的默认值
+	Retries         int                     // 失败后的最大重试次数
+	RetryBackoff    time.Duration           // 首次重试的等待时间，之后每次翻倍，默认 100 毫秒
+	RetryMaxBackoff time.Duration           // 重试等待时间上限，默认 2 秒
+	Retryable       func(err error) bool    // 判断错误是否可重试，为空时使用 IsRetryableError
+	Idempotent      func(fName string) bool // 判断方法是否幂等，为空时不重试也不对冲
+	HedgeDelay      time.Duration           // 请求超过该时间未返回时向同一代理再发一次，先返回的结果生效，不大于 0 时不对冲
+	MaxHedges       int                     // 每轮尝试的最大对冲次数，默认 1
+}
+
+// IsRetryableError 默认的可重试错误：超时、连接断开、发送队列或邮箱已满、服务不存在以及网络错误
+func IsRetryableError(err error) bool {
+	switch {
+	case errors.Is(err, ErrRequestTimeoutLocal),
+		errors.Is(err, ErrRequestTimeoutRemote),
+		errors.Is(err, ErrRemoteDisconnected),
+		errors.Is(err, ErrRemoteBufferFull),
+		errors.Is(err, ErrSendQueueFull),
+		errors.Is(err, ErrMailboxFull),
+		errors.Is(err, ErrServiceNotExist):
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+var _ iProxy = (*policyProxy)(nil)
+
+// policyProxy 为代理应用调用策略，非线程安全
+type policyProxy struct {
+	srv    *Service
+	inner  iProxy
+	policy CallPolicy
+}
+
+// CreateProxyWithOptions 根据服务名创建应用调用策略的代理，线程安全
+func (ss *Service) CreateProxyWithOptions(name string, policy *CallPolicy) IProxy {
+	proxy := ss.CreateProxy(name)
+	if proxy == nil {
+		return nil
+	}
+	return ss.CreatePolicyProxy(proxy, policy)
+}
+
+// CreatePolicyProxy 为已有代理应用调用策略，可与其他代理组合，如 CreatePolicyProxy(CreateCircuitBreakerProxy(...), ...)，线程安全
+func (ss *Service) CreatePolicyProxy(proxy IProxy, policy *CallPolicy) IProxy {
+	inner, ok := proxy.(iProxy)
+	if !ok || !proxy.Avail() || policy == nil {
+		return proxy
+	}
+
+	pp := &policyProxy{srv: ss, inner: inner, policy: *policy}
+	if pp.policy.RetryBackoff <= 0 {
+		pp.policy.RetryBackoff = defaultRetryBackoff
+	}
+	if pp.policy.RetryMaxBackoff <= 0 {
+		pp.policy.RetryMaxBackoff = defaultRetryMaxBackoff
+	}
+	if pp.policy.Retryable == nil {
+		pp.policy.Retryable = IsRetryableError
+	}
+	if pp.policy.MaxHedges <= 0 {
+		pp.policy.MaxHedges = 1
+	}
+	return pp
+}
+
+func (ss *policyProxy) Call(fName string, args ...any) IPromise {
+	return newPromise(ss, fName, args)
+}
+
+func (ss *policyProxy) GetNodeAddr() INodeAddr {
+	return ss.inner.GetNodeAddr()
+}
+
+func (ss *policyProxy) Avail() bool {
+	return ss.inner.Avail()
+}
+
+func (ss *policyProxy) getService() *Service {
+	return ss.srv
+}
+
+func (ss *policyProxy) doCall(p *promise) {
+	if p.timeout == -1 && ss.policy.Timeout > 0 {
+		p.timeout = ss.policy.Timeout
+	}
+
+	if p.successCb == nil || ss.policy.Idempotent == nil || !ss.policy.Idempotent(p.fName) ||
+		(ss.policy.Retries <= 0 && ss.policy.HedgeDelay <= 0) {
+		ss.inner.doCall(p)
+		return
+	}
+
+	fv := reflect.ValueOf(p.successCb)
+	if fv.Kind() != reflect.Func {
+		ss.inner.doCall(p)
+		return
+	}
+
+	if p.trace == 0 {
+		p.trace = ss.srv.traceOrNew()
+	}
+
+	c := &policyCall{proxy: ss, p: p, fv: fv, backoff: ss.policy.RetryBackoff}
+	p.cancel = c.cancel
+	c.round()
+}
+
+// policyCall 一次逻辑调用，可能包含多次重试及对冲尝试，回调均在服务主线程执行
+type policyCall struct {
+	proxy *policyProxy
+	p     *promise
+	fv    reflect.Value // 原始的成功回调
+
+	pending  int // 正在进行的尝试数
+	retries  int // 已重试次数
+	hedges   int // 本轮已对冲次数
+	backoff  time.Duration
+	lastErr  error
+	done     bool // 已有尝试成功或已放弃
+	finished bool // 已调用原始的 finalCb
+	hedge    ITimeWheelHandle
+	attempts []*promise // 进行中的尝试
+}
+
+// round 开始一轮尝试
+func (ss *policyCall) round() {
+	if ss.done {
+		return
+	}
+	ss.hedges = 0
+	ss.attempt()
+	ss.scheduleHedge()
+}
+
+func (ss *policyCall) attempt() {
+	p := ss.p
+	q := newPromise(ss.proxy.inner, p.fName, p.args)
+	q.timeout = p.timeout
+	q.trace = p.trace
+	ft := ss.fv.Type()
+	q.successCb = reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		if ss.done {
+			return zeroResults(ft)
+		}
+		return ss.onSuccess(q, args)
+	}).Interface()
+	q.errCb = func(err error) {
+		ss.lastErr = err
+	}
+	q.finalCb = func() {
+		ss.attempts = slices.DeleteFunc(ss.attempts, func(a *promise) bool { return a == q })
+		ss.onAttemptFinal()
+	}
+
+	ss.pending++
+	ss.attempts = append(ss.attempts, q)
+	ss.proxy.inner.doCall(q)
+}
+
+// onSuccess 首个成功的尝试回调原始的成功回调，并取消其余进行中的尝试
+func (ss *policyCall) onSuccess(winner *promise, args []reflect.Value) []reflect.Value {
+	ss.done = true
+	ss.stopHedge()
+
+	// 取消可能同步回调 finalCb，须在成功回调之后进行
+	defer func() {
+		for _, q := range slices.Clone(ss.attempts) {
+			if q != winner {
+				q.Cancel()
+			}
+		}
+	}()
+	return ss.fv.Call(args)
+}
+
+// cancel 取消进行中的尝试及之后的重试，以 ErrRequestCanceled 回调
+func (ss *policyCall) cancel() {
+	if ss.done {
+		return
+	}
+	ss.done = true
+	ss.stopHedge()
+	for _, q := range slices.Clone(ss.attempts) {
+		q.Cancel()
+	}
+
+	p := ss.p
+	srv := ss.proxy.srv
+	srv.Fork("policy.cancel", func() {
+		if p.errCb != nil {
+			srv.withTrace(p.trace, func() {
+				p.errCb(ErrRequestCanceled)
+			})
+		}
+		ss.finish()
+	})
+}
+
+func (ss *policyCall) scheduleHedge() {
+	delay := ss.proxy.policy.HedgeDelay
+	if delay <= 0 || ss.hedges >= ss.proxy.policy.MaxHedges {
+		return
+	}
+	ss.hedge = ss.proxy.srv.After(delay, func() {
+		ss.hedge = nil
+		if ss.done {
+			return
+		}
+		ss.hedges++
+		ss.attempt()
+		ss.scheduleHedge()
+	})
+}
+
+func (ss *policyCall) stopHedge() {
+	if ss.hedge != nil {
+		ss.hedge.Stop()
+		ss.hedge = nil
+	}
+}
+
+func (ss *policyCall) onAttemptFinal() {
+	ss.pending--
+	if ss.done {
+		ss.finish()
+		return
+	}
+
+	// 同一轮中仍有尝试未返回时等待其结果
+	if ss.pending > 0 {
+		return
+	}
+	ss.stopHedge()
+
+	policy := &ss.proxy.policy
+	if ss.retries < policy.Retries && ss.lastErr != nil && policy.Retryable(ss.lastErr) {
+		ss.retries++
+		delay := ss.backoff
+		ss.backoff = min(ss.backoff*2, policy.RetryMaxBackoff)
+		ss.proxy.srv.After(delay, ss.round)
+		return
+	}
+
+	ss.done = true
+	p := ss.p
+	err := ss.lastErr
+	if err == nil {
+		// 尝试结束时既未成功也未回调错误
+		err = ErrResponseInvalid
+	}
+	if p.errCb != nil {
+		ss.proxy.srv.withTrace(p.trace, func() {
+			p.errCb(err)
+		})
+	} else {
+		ss.proxy.srv.Errorf("rpc(%s) uncatched error: %+v", p.fName, err)
+	}
+	ss.finish()
+}
+
+func (ss *policyCall) finish() {
+	if ss.finished {
+		return
+	}
+	ss.finished = true
+
+	if ss.p.finalCb != nil {
+		ss.p.finalCb()
+	}
+	ss.p.clear()
+	ss.fv = reflect.Value{}
+	ss.attempts = nil
+}
+
+func zeroResults(ft reflect.Type) []reflect.Value {
+	res := make([]reflect.Value, ft.NumOut())
+	for i := range res {
+		res[i] = reflect.Zero(ft.Out(i))
+	}
+	return res
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newPolicyTestService() (*Service, time.Time) {
+	srv, _ := newBreakerTestService()
+	now := srv.GetTime()
+	srv.tw = newTimeWheel(now, 10*time.Millisecond)
+	return srv, now
+}
+
+func TestCallPolicyRetriesIdempotentRequests(t *testing.T) {
+	srv, now := newPolicyTestService()
+	inner := &testProxy{}
+	proxy := srv.CreatePolicyProxy(inner, &CallPolicy{
+		Timeout:      time.Second,
+		Retries:      2,
+		RetryBackoff: 100 * time.Millisecond,
+		Idempotent:   func(fName string) bool { return fName == "Get" },
+	})
+
+	var results []int
+	var errs []error
+	finals := 0
+	proxy.Call("Get").Then(func(v int) { results = append(results, v) }).Catch(func(err error) { errs = append(errs, err) }).Final(func() { finals++ }).Done()
+	require.Len(t, inner.calls, 1)
+	require.Equal(t, time.Second, inner.calls[0].timeout)
+	trace := inner.calls[0].trace
+	require.NotZero(t, trace)
+
+	inner.resolve(0, ErrRequestTimeoutLocal)
+	require.Len(t, inner.calls, 1)
+	srv.tw.update(now.Add(150 * time.Millisecond))
+	require.Len(t, inner.calls, 2)
+	require.Equal(t, trace, inner.calls[1].trace)
+
+	// 退避时间翻倍
+	inner.resolve(1, ErrRemoteDisconnected)
+	srv.tw.update(now.Add(300 * time.Millisecond))
+	require.Len(t, inner.calls, 2)
+	srv.tw.update(now.Add(400 * time.Millisecond))
+	require.Len(t, inner.calls, 3)
+
+	inner.calls[2].successCb.(func(int))(7)
+	inner.resolve(2, nil)
+	require.Equal(t, []int{7}, results)
+	require.Empty(t, errs)
+	require.Equal(t, 1, finals)
+
+	// 非幂等方法及不可重试的错误不重试
+	proxy.Call("Set").Then(func() {}).Catch(func(err error) { errs = append(errs, err) }).Done()
+	inner.resolve(3, ErrRequestTimeoutLocal)
+	proxy.Call("Get").Then(func(int) {}).Catch(func(err error) { errs = append(errs, err) }).Done()
+	businessErr := fmt.Errorf("business error")
+	inner.resolve(4, businessErr)
+	srv.tw.update(now.Add(time.Second))
+	require.Len(t, inner.calls, 5)
+	require.Equal(t, []error{ErrRequestTimeoutLocal, businessErr}, errs)
+}
+
+func TestCallPolicyHedgesSlowRequests(t *testing.T) {
+	srv, now := newPolicyTestService()
+	inner := &testProxy{}
+	proxy := srv.CreatePolicyProxy(inner, &CallPolicy{
+		Idempotent: func(string) bool { return true },
+		HedgeDelay: 50 * time.Millisecond,
+		MaxHedges:  1,
+	})
+
+	var results []int
+	var errs []error
+	finals := 0
+	proxy.Call("Get").Then(func(v int) { results = append(results, v) }).Catch(func(err error) { errs = append(errs, err) }).Final(func() { finals++ }).Done()
+	srv.tw.update(now.Add(100 * time.Millisecond))
+	require.Len(t, inner.calls, 2)
+	srv.tw.update(now.Add(300 * time.Millisecond))
+	require.Len(t, inner.calls, 2)
+
+	// 对冲请求先返回，原请求被取消，其结果被忽略
+	var canceled []int
+	inner.calls[0].cancel = func() { canceled = append(canceled, 0) }
+	inner.calls[1].cancel = func() { canceled = append(canceled, 1) }
+	inner.calls[1].successCb.(func(int))(2)
+	require.Equal(t, []int{0}, canceled)
+	inner.resolve(1, nil)
+	inner.calls[0].successCb.(func(int))(1)
+	inner.resolve(0, nil)
+	require.Equal(t, []int{2}, results)
+	require.Equal(t, 1, finals)
+
+	// 全部尝试失败后才返回错误
+	proxy.Call("Get").Then(func(int) {}).Catch(func(err error) { errs = append(errs, err) }).Done()
+	srv.tw.update(now.Add(400 * time.Millisecond))
+	require.Len(t, inner.calls, 4)
+	inner.resolve(2, ErrRequestTimeoutLocal)
+	require.Empty(t, errs)
+	inner.resolve(3, ErrRemoteDisconnected)
+	require.Equal(t, []error{ErrRemoteDisconnected}, errs)
+}
+
+func TestCallPolicyNeverCatchesNilError(t *testing.T) {
+	srv, now := newPolicyTestService()
+	inner := &testProxy{}
+	proxy := srv.CreatePolicyProxy(inner, &CallPolicy{
+		Retries:    2,
+		Idempotent: func(string) bool { return true },
+	})
+
+	// 尝试结束时既未成功也未回调错误，如响应与回调不匹配
+	var errs []error
+	proxy.Call("Get").Then(func(int) {}).Catch(func(err error) { errs = append(errs, err) }).Done()
+	inner.resolve(0, nil)
+	srv.tw.update(now.Add(time.Second))
+	require.Len(t, inner.calls, 1)
+	require.Equal(t, []error{ErrResponseInvalid}, errs)
+}
@@ -26,6 +26,9 @@ func (ss *dumbPromise) Timeout(_ time.Duration) IPromise {
 func (ss *dumbPromise) Done() {
 }
 
+func (ss *dumbPromise) Cancel() {
+}
+
 var _ IPromise = (*promise)(nil)
 
 func _emptyThen() {}
@@ -34,10 +37,12 @@ type promise struct {
 	proxy     iProxy
 	fName     string
 	timeout   time.Duration
+	trace     int64
 	args      []any
 	successCb any
 	errCb     func(error)
 	finalCb   func()
+	cancel    func() // 由 doCall 设置，调用结束后清空
 }
 
 func newPromise(proxy iProxy, fName string, args []any) *promise {
@@ -76,9 +81,16 @@ func (ss *promise) Done() {
 	ss.proxy.doCall(ss)
 }
 
+func (ss *promise) Cancel() {
+	if ss.cancel != nil {
+		ss.cancel()
+	}
+}
+
 func (ss *promise) clear() {
 	ss.args = nil
 	ss.successCb = nil
 	ss.errCb = nil
 	ss.finalCb = nil
+	ss.cancel = nil
 }
@@ -0,0 +1,308 @@
+package node
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrPromiseInvalid = fmt.Errorf("invalid promise")
+
+type combineKind int
+
+const (
+	combineAll combineKind = iota
+	combineAny
+	combineRace
+)
+
+var _ IPromise = (*combinedPromise)(nil)
+
+// combinedPromise 组合多个调用，各调用自身的 Then/Catch/Final/Timeout 照常生效，组合的回调通过 Fork 在服务主线程中执行，非线程安全
+type combinedPromise struct {
+	kind      combineKind
+	members   []IPromise
+	timeout   time.Duration
+	successCb any
+	errCb     func(error)
+	finalCb   func()
+
+	calls    []IPromise
+	srv      *Service
+	trace    int64
+	pending  int
+	firstErr error
+	settled  bool
+	timer    ITimeWheelHandle
+}
+
+// PromiseAll 全部调用成功后以 func() 回调 Then，任一调用失败时以该错误回调 Catch；调用结果通过各自的 Then 获取。
+// 成员可以是任意 IPromise，包括其他组合及类型化调用内嵌的 IPromise
+//
+//	var a, b int
+//	node.PromiseAll(
+//		p1.Call("GetA").Then(func(v int) { a = v }),
+//		p2.Call("GetB").Then(func(v int) { b = v }),
+//	).Then(func() { ... }).Catch(func(err error) { ... }).Done()
+func PromiseAll(promises ...IPromise) IPromise {
+	return newCombinedPromise(combineAll, promises)
+}
+
+// PromiseAny 任一调用成功后以 func(index int) 回调 Then，全部失败时以首个错误回调 Catch
+func PromiseAny(promises ...IPromise) IPromise {
+	return newCombinedPromise(combineAny, promises)
+}
+
+// PromiseRace 首个完成的调用成功时以 func(index int) 回调 Then，失败时以其错误回调 Catch
+func PromiseRace(promises ...IPromise) IPromise {
+	return newCombinedPromise(combineRace, promises)
+}
+
+func newCombinedPromise(kind combineKind, promises []IPromise) *combinedPromise {
+	return &combinedPromise{
+		kind:    kind,
+		members: promises,
+		timeout: -1,
+	}
+}
+
+// Then PromiseAll 接受 func()，PromiseAny 及 PromiseRace 接受 func(index int)
+func (ss *combinedPromise) Then(f any) IPromise {
+	ss.successCb = f
+	return ss
+}
+
+func (ss *combinedPromise) Catch(f func(error)) IPromise {
+	ss.errCb = f
+	return ss
+}
+
+func (ss *combinedPromise) Final(f func()) IPromise {
+	ss.finalCb = f
+	return ss
+}
+
+// Timeout 组合整体的超时，超时后以 ErrRequestTimeoutLocal 回调 Catch，之后各调用的结果不再影响组合
+func (ss *combinedPromise) Timeout(timeout time.Duration) IPromise {
+	ss.timeout = timeout
+	return ss
+}
+
+// Done 发起全部调用，须在服务主线程中调用
+func (ss *combinedPromise) Done() {
+	ss.srv = ss.service()
+	members := ss.members
+	ss.members = nil
+	ss.calls = members
+
+	if ss.srv != nil {
+		ss.trace = ss.srv.GetTraceID()
+		if ss.timeout > 0 {
+			ss.timer = ss.srv.After(ss.timeout, func() {
+				ss.timer = nil
+				ss.settle(-1, ErrRequestTimeoutLocal)
+			})
+		}
+	}
+
+	ss.pending = len(members)
+	if ss.pending == 0 {
+		if ss.kind == combineAll {
+			ss.settle(-1, nil)
+		} else {
+			ss.settle(-1, ErrPromiseInvalid)
+		}
+		return
+	}
+
+	for i, m := range members {
+		index := i
+		done := func(err error) {
+			if err != nil {
+				ss.onError(err)
+			} else {
+				ss.onSuccess(index)
+			}
+		}
+		switch p := m.(type) {
+		case nil:
+			// 不可用的代理返回的调用直接视为失败
+			done(ErrPromiseInvalid)
+		case promiseHook:
+			p.hook(done)
+		default:
+			// 未知实现只能通过 Catch/Final 监听，调用自身设置的 Catch/Final 被替换
+			var failed error
+			p.Catch(func(err error) { failed = err }).Final(func() { done(failed) })
+		}
+	}
+	for _, m := range members {
+		if m != nil {
+			m.Done()
+		}
+	}
+}
+
+// Cancel 取消全部调用，以 ErrRequestCanceled 回调 Catch
+func (ss *combinedPromise) Cancel() {
+	if ss.calls == nil || ss.settled {
+		return
+	}
+	calls := ss.calls
+	ss.settle(-1, ErrRequestCanceled)
+	for _, m := range calls {
+		if m != nil {
+			m.Cancel()
+		}
+	}
+}
+
+// promiseHook 由框架内的调用实现，监听结果时保留调用自身的回调
+type promiseHook interface {
+	// hook 在调用自身的回调之后以 nil 或错误回调 done，仅回调一次
+	hook(done func(error))
+	// service 返回执行回调的服务，未知时返回 nil
+	service() *Service
+}
+
+var (
+	_ promiseHook = (*promise)(nil)
+	_ promiseHook = (*combinedPromise)(nil)
+	_ promiseHook = (*dumbPromise)(nil)
+)
+
+// hook 调用的 finalCb 总在成功或失败回调之后执行
+func (ss *promise) hook(done func(error)) {
+	var failed error
+	errCb := ss.errCb
+	ss.errCb = func(err error) {
+		failed = err
+		if errCb != nil {
+			errCb(err)
+		}
+	}
+	finalCb := ss.finalCb
+	ss.finalCb = func() {
+		if finalCb != nil {
+			finalCb()
+		}
+		done(failed)
+	}
+}
+
+func (ss *promise) service() *Service {
+	if ss.proxy == nil {
+		return nil
+	}
+	return ss.proxy.getService()
+}
+
+// hook 组合的 finalCb 总在成功或失败回调之后执行，用于嵌套组合
+func (ss *combinedPromise) hook(done func(error)) {
+	var failed error
+	errCb := ss.errCb
+	ss.errCb = func(err error) {
+		failed = err
+		if errCb != nil {
+			errCb(err)
+		}
+	}
+	finalCb := ss.finalCb
+	ss.finalCb = func() {
+		if finalCb != nil {
+			finalCb()
+		}
+		done(failed)
+	}
+}
+
+func (ss *combinedPromise) service() *Service {
+	if ss.srv != nil {
+		return ss.srv
+	}
+	for _, m := range ss.members {
+		if p, ok := m.(promiseHook); ok {
+			if srv := p.service(); srv != nil {
+				return srv
+			}
+		}
+	}
+	return nil
+}
+
+// hook 空调用不会完成，直接视为失败
+func (ss *dumbPromise) hook(done func(error)) {
+	done(ErrPromiseInvalid)
+}
+
+func (ss *dumbPromise) service() *Service {
+	return nil
+}
+
+func (ss *combinedPromise) onSuccess(index int) {
+	ss.pending--
+	switch ss.kind {
+	case combineAll:
+		if ss.pending == 0 {
+			ss.settle(-1, nil)
+		}
+	default:
+		ss.settle(index, nil)
+	}
+}
+
+func (ss *combinedPromise) onError(err error) {
+	ss.pending--
+	if ss.firstErr == nil {
+		ss.firstErr = err
+	}
+	if ss.kind != combineAny || ss.pending == 0 {
+		ss.settle(-1, ss.firstErr)
+	}
+}
+
+func (ss *combinedPromise) settle(index int, err error) {
+	if ss.settled {
+		return
+	}
+	ss.settled = true
+	ss.calls = nil
+	if ss.timer != nil {
+		ss.timer.Stop()
+		ss.timer = nil
+	}
+
+	f := func() {
+		if err != nil {
+			if ss.errCb != nil {
+				ss.errCb(err)
+			} else if ss.srv != nil {
+				ss.srv.Errorf("combined promise uncatched error: %+v", err)
+			}
+		} else {
+			switch cb := ss.successCb.(type) {
+			case nil:
+			case func():
+				cb()
+			case func(int):
+				cb(index)
+			default:
+				if ss.srv != nil {
+					ss.srv.Errorf("combined promise invalid success callback: %T", ss.successCb)
+				}
+			}
+		}
+		if ss.finalCb != nil {
+			ss.finalCb()
+		}
+		ss.successCb, ss.errCb, ss.finalCb = nil, nil, nil
+	}
+
+	if ss.srv == nil {
+		f()
+		return
+	}
+	trace := ss.trace
+	ss.srv.Fork("promise.combine", func() {
+		ss.srv.withTrace(trace, f)
+	})
+}
@@ -0,0 +1,172 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromiseAllWaitsForEveryCall(t *testing.T) {
+	srv, _ := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var a, b int
+	var errs []error
+	done, finals := 0, 0
+	PromiseAll(
+		inner.Call("GetA").Then(func(v int) { a = v }),
+		inner.Call("GetB").Then(func(v int) { b = v }),
+		inner.Call("Notify"),
+	).Then(func() { done++ }).Catch(func(err error) { errs = append(errs, err) }).Final(func() { finals++ }).Done()
+	require.Len(t, inner.calls, 3)
+
+	inner.calls[0].successCb.(func(int))(1)
+	inner.resolve(0, nil)
+	inner.resolve(2, nil)
+	runForked(srv)
+	require.Zero(t, done)
+
+	inner.calls[1].successCb.(func(int))(2)
+	inner.resolve(1, nil)
+	require.Zero(t, done)
+	runForked(srv)
+	require.Equal(t, 1, done)
+	require.Equal(t, 1, finals)
+	require.Equal(t, []int{1, 2}, []int{a, b})
+	require.Empty(t, errs)
+
+	// 首个错误回调 Catch，之后的结果被忽略
+	memberErrs := 0
+	PromiseAll(
+		inner.Call("GetA").Then(func(int) {}).Catch(func(error) { memberErrs++ }),
+		inner.Call("GetB").Then(func(int) {}),
+	).Then(func() { done++ }).Catch(func(err error) { errs = append(errs, err) }).Final(func() { finals++ }).Done()
+	inner.resolve(3, ErrRemoteDisconnected)
+	inner.resolve(4, ErrRequestTimeoutLocal)
+	runForked(srv)
+	require.Equal(t, 1, done)
+	require.Equal(t, 2, finals)
+	require.Equal(t, 1, memberErrs)
+	require.Equal(t, []error{ErrRemoteDisconnected}, errs)
+}
+
+func TestPromiseAnyAndRace(t *testing.T) {
+	srv, _ := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var picked []int
+	var errs []error
+	PromiseAny(
+		inner.Call("Get").Then(func() {}),
+		inner.Call("Get").Then(func() {}),
+	).Then(func(i int) { picked = append(picked, i) }).Catch(func(err error) { errs = append(errs, err) }).Done()
+	inner.resolve(0, ErrRemoteDisconnected)
+	inner.resolve(1, nil)
+	runForked(srv)
+	require.Equal(t, []int{1}, picked)
+	require.Empty(t, errs)
+
+	firstErr := fmt.Errorf("first")
+	PromiseAny(
+		inner.Call("Get").Then(func() {}),
+		inner.Call("Get").Then(func() {}),
+	).Then(func(i int) { picked = append(picked, i) }).Catch(func(err error) { errs = append(errs, err) }).Done()
+	inner.resolve(3, firstErr)
+	inner.resolve(2, ErrRemoteDisconnected)
+	runForked(srv)
+	require.Equal(t, []error{firstErr}, errs)
+
+	PromiseRace(
+		inner.Call("Get").Then(func() {}),
+		inner.Call("Get").Then(func() {}),
+	).Then(func(i int) { picked = append(picked, i) }).Catch(func(err error) { errs = append(errs, err) }).Done()
+	inner.resolve(5, ErrRemoteDisconnected)
+	inner.resolve(4, nil)
+	runForked(srv)
+	require.Equal(t, []int{1}, picked)
+	require.Equal(t, []error{firstErr, ErrRemoteDisconnected}, errs)
+}
+
+func TestPromiseCombineTimeout(t *testing.T) {
+	srv, now := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var errs []error
+	done := 0
+	PromiseAll(
+		inner.Call("Get").Then(func() {}),
+	).Then(func() { done++ }).Catch(func(err error) { errs = append(errs, err) }).Timeout(100 * time.Millisecond).Done()
+	srv.tw.update(now.Add(200 * time.Millisecond))
+	inner.resolve(0, nil)
+	runForked(srv)
+	require.Zero(t, done)
+	require.Equal(t, []error{ErrRequestTimeoutLocal}, errs)
+}
+
+// foreignPromise 为框架外的 IPromise 实现，只能通过接口监听
+type foreignPromise struct {
+	errCb   func(error)
+	finalCb func()
+	done    bool
+}
+
+func (ss *foreignPromise) Then(_ any) IPromise              { return ss }
+func (ss *foreignPromise) Catch(f func(error)) IPromise     { ss.errCb = f; return ss }
+func (ss *foreignPromise) Final(f func()) IPromise          { ss.finalCb = f; return ss }
+func (ss *foreignPromise) Timeout(_ time.Duration) IPromise { return ss }
+func (ss *foreignPromise) Done()                            { ss.done = true }
+func (ss *foreignPromise) Cancel()                          {}
+
+func (ss *foreignPromise) resolve(err error) {
+	if err != nil && ss.errCb != nil {
+		ss.errCb(err)
+	}
+	if ss.finalCb != nil {
+		ss.finalCb()
+	}
+}
+
+func TestPromiseCombineAcceptsAnyPromise(t *testing.T) {
+	srv, _ := newPolicyTestService()
+	inner := &testProxy{srv: srv}
+
+	var got string
+	innerDone, innerFinals := 0, 0
+	foreign := &foreignPromise{}
+	var picked []int
+	var errs []error
+	PromiseAny(
+		&dumbPromise{},
+		PromiseAll(
+			Promise1[string]{IPromise: inner.Call("Get")}.Then(func(v string) { got = v }).IPromise,
+			foreign,
+		).Then(func() { innerDone++ }).Final(func() { innerFinals++ }),
+	).Then(func(i int) { picked = append(picked, i) }).Catch(func(err error) { errs = append(errs, err) }).Done()
+	require.True(t, foreign.done)
+	require.Len(t, inner.calls, 1)
+
+	inner.calls[0].successCb.(func(string))("pong")
+	inner.resolve(0, nil)
+	foreign.resolve(nil)
+	runForked(srv)
+	runForked(srv)
+	require.Equal(t, "pong", got)
+	require.Equal(t, 1, innerDone)
+	require.Equal(t, 1, innerFinals)
+	require.Equal(t, []int{1}, picked)
+	require.Empty(t, errs)
+
+	// 嵌套组合的失败传递给外层
+	foreign = &foreignPromise{}
+	PromiseAll(
+		PromiseRace(foreign),
+		inner.Call("Get"),
+	).Then(func() { innerDone++ }).Catch(func(err error) { errs = append(errs, err) }).Done()
+	foreign.resolve(ErrRemoteDisconnected)
+	runForked(srv)
+	runForked(srv)
+	require.Equal(t, 1, innerDone)
+	require.Equal(t, []error{ErrRemoteDisconnected}, errs)
+}
@@ -0,0 +1,119 @@
+package node
+
+import "time"
+
+// Promise0 ~ Promise4 为类型化的调用，由 snowgen 生成的代理返回，Then 的参数类型与被调用方 Return 的参数一致，
+// 编译期即可检查；需要 IPromise 时（如 PromiseAll、Await）直接使用内嵌的 IPromise
+//
+//	pong := NewPongProxy(ss.CreateProxy("Pong"))
+//	pong.Hello("ping").Then(func(ret string) { ... }).Done()
+
+type Promise0 struct{ IPromise }
+
+func (ss Promise0) Then(f func()) Promise0 {
+	ss.IPromise.Then(f)
+	return ss
+}
+
+func (ss Promise0) Catch(f func(error)) Promise0 {
+	ss.IPromise.Catch(f)
+	return ss
+}
+
+func (ss Promise0) Final(f func()) Promise0 {
+	ss.IPromise.Final(f)
+	return ss
+}
+
+func (ss Promise0) Timeout(timeout time.Duration) Promise0 {
+	ss.IPromise.Timeout(timeout)
+	return ss
+}
+
+type Promise1[T any] struct{ IPromise }
+
+func (ss Promise1[T]) Then(f func(T)) Promise1[T] {
+	ss.IPromise.Then(f)
+	return ss
+}
+
+func (ss Promise1[T]) Catch(f func(error)) Promise1[T] {
+	ss.IPromise.Catch(f)
+	return ss
+}
+
+func (ss Promise1[T]) Final(f func()) Promise1[T] {
+	ss.IPromise.Final(f)
+	return ss
+}
+
+func (ss Promise1[T]) Timeout(timeout time.Duration) Promise1[T] {
+	ss.IPromise.Timeout(timeout)
+	return ss
+}
+
+type Promise2[T1, T2 any] struct{ IPromise }
+
+func (ss Promise2[T1, T2]) Then(f func(T1, T2)) Promise2[T1, T2] {
+	ss.IPromise.Then(f)
+	return ss
+}
+
+func (ss Promise2[T1, T2]) Catch(f func(error)) Promise2[T1, T2] {
+	ss.IPromise.Catch(f)
+	return ss
+}
+
+func (ss Promise2[T1, T2]) Final(f func()) Promise2[T1, T2] {
+	ss.IPromise.Final(f)
+	return ss
+}
+
+func (ss Promise2[T1, T2]) Timeout(timeout time.Duration) Promise2[T1, T2] {
+	ss.IPromise.Timeout(timeout)
+	return ss
+}
+
+type Promise3[T1, T2, T3 any] struct{ IPromise }
+
+func (ss Promise3[T1, T2, T3]) Then(f func(T1, T2, T3)) Promise3[T1, T2, T3] {
+	ss.IPromise.Then(f)
+	return ss
+}
+
+func (ss Promise3[T1, T2, T3]) Catch(f func(error)) Promise3[T1, T2, T3] {
+	ss.IPromise.Catch(f)
+	return ss
+}
+
+func (ss Promise3[T1, T2, T3]) Final(f func()) Promise3[T1, T2, T3] {
+	ss.IPromise.Final(f)
+	return ss
+}
+
+func (ss Promise3[T1, T2, T3]) Timeout(timeout time.Duration) Promise3[T1, T2, T3] {
+	ss.IPromise.Timeout(timeout)
+	return ss
+}
+
+type Promise4[T1, T2, T3, T4 any] struct{ IPromise }
+
+func (ss Promise4[T1, T2, T3, T4]) Then(f func(T1, T2, T3, T4)) Promise4[T1, T2, T3, T4] {
+	ss.IPromise.Then(f)
+	return ss
+}
+
+func (ss Promise4[T1, T2, T3, T4]) Catch(f func(error)) Promise4[T1, T2, T3, T4] {
+	ss.IPromise.Catch(f)
+	return ss
+}
+
+func (ss Promise4[T1, T2, T3, T4]) Final(f func()) Promise4[T1, T2, T3, T4] {
+	ss.IPromise.Final(f)
+	return ss
+}
+
+func (ss Promise4[T1, T2, T3, T4]) Timeout(timeout time.Duration) Promise4[T1, T2, T3, T4] {
+	ss.IPromise.Timeout(timeout)
+	return ss
+}
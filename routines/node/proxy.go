@@ -4,19 +4,24 @@ import (
 	"fmt"
 	"reflect"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	ErrServiceNotExist      = fmt.Errorf("service not exist")
+	ErrServiceStartFailed   = fmt.Errorf("service start failed")
 	ErrNodeMessageChanFull  = fmt.Errorf("note message chan full")
 	ErrRequestTimeoutRemote = fmt.Errorf("session timeout from remote")
 	ErrRequestTimeoutLocal  = fmt.Errorf("session timeout from local")
+	ErrRequestCanceled      = fmt.Errorf("request canceled")
+	ErrResponseInvalid      = fmt.Errorf("response invalid") // 响应与 Then 回调的参数不匹配，或回调不是函数
 )
 
 type iProxy interface {
 	IProxy
 
+	getService() *Service
 	doCall(*promise)
 }
 
@@ -28,6 +33,10 @@ type serviceProxy struct {
 	nAddrUpdater *AddrUpdater
 	sAddr        int32
 	sender       iMessageSender
+	senderAddr   Addr
+
+	discovery *discovery // 非空时每次调用通过服务发现解析节点地址
+	name      string
 
 	bufferFullCB func()
 	buffer       []*promise
@@ -50,6 +59,10 @@ func (ss *serviceProxy) GetNodeAddr() INodeAddr {
 		return ss.nAddrUpdater.GetNodeAddr()
 	}
 
+	if ss.discovery != nil {
+		return ss.discovery.lookup(ss.name)
+	}
+
 	return ss.nAddr
 }
 
@@ -57,6 +70,10 @@ func (ss *serviceProxy) Avail() bool {
 	return ss.sAddr != 0
 }
 
+func (ss *serviceProxy) getService() *Service {
+	return ss.srv
+}
+
 func (ss *serviceProxy) doCall(p *promise) {
 	if ss.sAddr == 0 {
 		if ss.buffer != nil {
@@ -74,25 +91,25 @@ func (ss *serviceProxy) doCall(p *promise) {
 	}
 	srv := ss.srv
 
+	if p.trace == 0 {
+		p.trace = srv.traceOrNew()
+	}
+
 	m := &message{
 		timeout: p.timeout,
 		src:     srv.GetAddr(),
 		dst:     ss.sAddr,
-		// TODO trace id
+		trace:   p.trace,
 	}
 	m.writeRequest(p.fName, p.args)
 
-	if ss.sender == nil || ss.sender.closed() {
-		var retrySignal func()
-		if ss.nAddrUpdater != nil {
-			retrySignal = ss.nAddrUpdater.signalRefresh
-		}
-		ss.sender = nodeGetMessageSender(ss.GetNodeAddr().(Addr), ss.sAddr, true, retrySignal)
-	}
-	if ss.sender == nil {
+	if ss.getSender() == nil {
 		if p.errCb != nil {
+			trace := p.trace
 			srv.Fork("proxy.err.cb", func() {
-				p.errCb(ErrServiceNotExist)
+				srv.withTrace(trace, func() {
+					p.errCb(ErrServiceNotExist)
+				})
 			})
 		} else {
 			srv.Errorf("rpc(%s) uncatched error: %+v", p.fName, ErrServiceNotExist)
@@ -126,15 +143,38 @@ func (ss *serviceProxy) doCall(p *promise) {
 		}
 		m.cb = cb
 		m.sess = sess
+		if p.timeout > 0 {
+			// 被调用方据此放弃执行已超时的请求
+			m.deadline = time.Now().Add(p.timeout).UnixNano()
+		}
+
+		// 超时或取消后通知被调用方放弃执行，并结束会话
+		sender := ss.sender
+		abort := func(err error) {
+			if p.timeout == -1 {
+				return
+			}
+			sender.send(&message{
+				src:   srv.GetAddr(),
+				dst:   ss.sAddr,
+				sess:  sess,
+				trace: trace,
+				flag:  msgFlagCancel,
+			})
+			cb(&message{
+				trace: trace,
+				err:   err,
+			})
+		}
+		p.cancel = func() {
+			abort(ErrRequestCanceled)
+		}
+
 		timeout := p.timeout
 		if timeout > 0 {
 			srv.Fork("proxy.timeoutCallBack", func() {
 				srv.After(timeout, func() {
-					om := &message{
-						trace: trace,
-						err:   ErrRequestTimeoutLocal,
-					}
-					cb(om)
+					abort(ErrRequestTimeoutLocal)
 				})
 			})
 		}
@@ -143,6 +183,15 @@ func (ss *serviceProxy) doCall(p *promise) {
 	ss.sender.send(m)
 }
 
+// getSender 获取消息发送者，连接关闭或节点地址变化时重新获取
+func (ss *serviceProxy) getSender() iMessageSender {
+	if ss.sender == nil || ss.sender.closed() || ((ss.discovery != nil || ss.nAddrUpdater != nil) && ss.GetNodeAddr() != ss.senderAddr) {
+		ss.senderAddr = ss.GetNodeAddr().(Addr)
+		ss.sender = nodeGetMessageSender(ss.senderAddr, ss.sAddr, true, ss.nAddrUpdater)
+	}
+	return ss.sender
+}
+
 func (ss *serviceProxy) callThen(mm *message, srv *Service, p *promise, sess int32) {
 	srv.Fork("proxy.forkCb", func() {
 		if p.timeout == -1 {
@@ -150,6 +199,9 @@ func (ss *serviceProxy) callThen(mm *message, srv *Service, p *promise, sess int
 		}
 		p.timeout = -1
 
+		old := atomic.SwapInt64(&srv.curTrace, p.trace)
+		defer atomic.StoreInt64(&srv.curTrace, old)
+
 		defer func() {
 			if p.finalCb != nil {
 				p.finalCb()
@@ -167,16 +219,25 @@ func (ss *serviceProxy) callThen(mm *message, srv *Service, p *promise, sess int
 			return
 		}
 
+		// 响应无法交给 Then 回调时同样以错误结束，调用方不会既收不到结果也收不到错误
+		fail := func(err error) {
+			if p.errCb != nil {
+				p.errCb(err)
+			} else {
+				srv.Errorf("rpc(%s:%v) response error: %+v", p.fName, sess, err)
+			}
+		}
+
 		fv := reflect.ValueOf(p.successCb)
-		if !fv.IsValid() {
-			srv.Errorf("rpc(%s:%v) invalid success callback", p.fName, sess)
+		if fv.Kind() != reflect.Func {
+			fail(fmt.Errorf("%w: success callback is not a function", ErrResponseInvalid))
 			return
 		}
 
 		ft := fv.Type()
 		fArgs, err := mm.getResponse(ft)
 		if err != nil {
-			srv.Errorf("rpc(%s:%v) response error: %+v", p.fName, sess, err)
+			fail(fmt.Errorf("%w: %v", ErrResponseInvalid, err))
 			return
 		}
 
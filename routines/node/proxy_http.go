@@ -2,13 +2,16 @@ package node
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/mogud/snow/core/logging"
 	"github.com/mogud/snow/core/task"
 	"io"
 	"net/http"
 	"reflect"
 	"runtime/debug"
+	"sync/atomic"
 )
 
 const httpRpcPathPrefix = "/node/rpc/"
@@ -32,30 +35,75 @@ type httpProxy struct {
 	httpClient *http.Client
 }
 
-func (ss *httpProxy) onError(p *promise, err error) {
-	defer func() {
-		ss.srv.Fork("httpProxy.doCall.finalCb", func() {
+// httpCall 一次 HTTP 调用的状态，settled 仅在服务主线程中读写
+type httpCall struct {
+	p       *promise
+	settled bool
+}
+
+// settle 于服务主线程中结束调用，已被取消的调用不再回调
+func (ss *httpProxy) settle(c *httpCall, name string, f func()) {
+	ss.srv.Fork(name, func() {
+		if c.settled {
+			return
+		}
+		c.settled = true
+
+		p := c.p
+		defer func() {
 			if p.finalCb != nil {
 				p.finalCb()
 			}
 			p.clear()
-		})
-	}()
-
-	if p.errCb != nil {
-		ss.srv.Fork("httpProxy.doCall.errCb", func() {
-			p.errCb(err)
-		})
-	} else {
-		ss.srv.Errorf("httpRpc(%s) uncatched error: %+v", p.fName, err)
-	}
+		}()
+		f()
+	})
+}
+
+func (ss *httpProxy) onError(c *httpCall, err error) {
+	p := c.p
+	ss.settle(c, "httpProxy.doCall.errCb", func() {
+		if p.errCb != nil {
+			ss.srv.withTrace(p.trace, func() {
+				p.errCb(err)
+			})
+		} else {
+			ss.srv.Errorf("httpRpc(%s) uncatched error: %+v", p.fName, err)
+		}
+	})
 }
 
 func (ss *httpProxy) doCall(p *promise) {
+	if p.trace == 0 {
+		p.trace = ss.srv.traceOrNew()
+	}
+
+	// 取消时中止请求，并以 ErrRequestCanceled 结束调用
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &httpCall{p: p}
+	p.cancel = func() {
+		if c.settled {
+			return
+		}
+		cancel()
+		c.settled = true
+		if p.errCb != nil {
+			ss.srv.withTrace(p.trace, func() {
+				p.errCb(ErrRequestCanceled)
+			})
+		}
+		if p.finalCb != nil {
+			p.finalCb()
+		}
+		p.clear()
+	}
+
 	task.Execute(func() {
+		defer cancel()
+
 		argsStr, err := jsoniter.Marshal(p.args)
 		if err != nil {
-			ss.onError(p, err)
+			ss.onError(c, err)
 			return
 		}
 
@@ -69,56 +117,60 @@ func (ss *httpProxy) doCall(p *promise) {
 		if p.timeout == -1 {
 			httpClient = ss.httpClient
 		} else {
-			c := *ss.httpClient
-			httpClient = &c
+			hc := *ss.httpClient
+			httpClient = &hc
 			httpClient.Timeout = p.timeout
 		}
 
 		bs, _ := jsoniter.ConfigDefault.Marshal(req)
-		resp, err := httpClient.Post(ss.url, "application/json", bytes.NewBuffer(bs))
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, ss.url, bytes.NewBuffer(bs))
+		if err != nil {
+			ss.onError(c, err)
+			return
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set(httpTraceHeader, logging.FormatTraceID(p.trace))
+
+		resp, err := httpClient.Do(httpReq)
 		if err != nil {
-			ss.onError(p, err)
+			ss.onError(c, err)
 			return
 		}
 
-		ss.prepareThen(p, resp)
+		ss.prepareThen(c, resp)
 	})
 }
 
-func (ss *httpProxy) prepareThen(p *promise, resp *http.Response) {
+func (ss *httpProxy) prepareThen(c *httpCall, resp *http.Response) {
+	p := c.p
 	rspBody, err := io.ReadAll(resp.Body)
 	_ = resp.Body.Close()
 
 	if err != nil {
-		ss.onError(p, err)
+		ss.onError(c, err)
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		ss.onError(p, fmt.Errorf("http response code(%v): %v", resp.StatusCode, string(rspBody)))
+		ss.onError(c, fmt.Errorf("http response code(%v): %v", resp.StatusCode, string(rspBody)))
 		return
 	}
 
 	if p.successCb == nil {
-		ss.srv.Fork("httpProxy.post.finalCb.noSuccessor", func() {
-			if p.finalCb != nil {
-				p.finalCb()
-			}
-			p.clear()
-		})
+		ss.settle(c, "httpProxy.post.finalCb.noSuccessor", func() {})
 		return
 	}
 
 	fv := reflect.ValueOf(p.successCb)
 	if !fv.IsValid() {
-		ss.onError(p, fmt.Errorf("invalid success callback"))
+		ss.onError(c, fmt.Errorf("invalid success callback"))
 		return
 	}
 
 	var rsp httpResponse
 	err = jsoniter.Unmarshal(rspBody, &rsp)
 	if err != nil {
-		ss.onError(p, err)
+		ss.onError(c, err)
 		return
 	}
 
@@ -128,7 +180,7 @@ func (ss *httpProxy) prepareThen(p *promise, resp *http.Response) {
 		resArgs = append(resArgs, reflect.New(ft.In(i)).Interface())
 	}
 	if err = jsoniter.Unmarshal(rsp.Result, &resArgs); err != nil {
-		ss.onError(p, err)
+		ss.onError(c, err)
 		return
 	}
 
@@ -141,21 +193,20 @@ func (ss *httpProxy) prepareThen(p *promise, resp *http.Response) {
 		}
 	}
 
-	ss.callThen(p, fv, fArgs)
+	ss.callThen(c, fv, fArgs)
 }
 
-func (ss *httpProxy) callThen(p *promise, fv reflect.Value, fArgs []reflect.Value) {
-	ss.srv.Fork("httpProxy.fork", func() {
+func (ss *httpProxy) callThen(c *httpCall, fv reflect.Value, fArgs []reflect.Value) {
+	p := c.p
+	ss.settle(c, "httpProxy.fork", func() {
+		old := atomic.SwapInt64(&ss.srv.curTrace, p.trace)
+		defer atomic.StoreInt64(&ss.srv.curTrace, old)
+
 		panicked := true
 		defer func() {
 			if panicked {
 				ss.srv.Errorf("httpRpc(%s) response got panic: %v", p.fName, string(debug.Stack()))
 			}
-
-			if p.finalCb != nil {
-				p.finalCb()
-			}
-			p.clear()
 		}()
 
 		fRet := fv.Call(fArgs)
@@ -188,3 +239,7 @@ func (ss *httpProxy) GetNodeAddr() INodeAddr {
 func (ss *httpProxy) Avail() bool {
 	return true
 }
+
+func (ss *httpProxy) getService() *Service {
+	return ss.srv
+}
@@ -28,8 +28,9 @@ func TestProxyPreservesCallOrderForSameSourceAndTarget(t *testing.T) {
 	t.Run("loopback remote sender", func(t *testing.T) {
 		client, server := loopbackTCPPair(t)
 		handle := newRemoteHandle(&Node{}, Addr(101), client)
+		handle.connected.Store(true)
 		handle.wg.Add(1)
-		go handle.doSend()
+		go handle.doSend(handle.ctx, handle.cancel, client)
 		t.Cleanup(func() {
 			handle.cancel()
 			_ = client.Close()
@@ -0,0 +1,467 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mogud/snow/core/logging/slog"
+	"github.com/mogud/snow/core/task"
+)
+
+var (
+	ErrTopicInvalid        = fmt.Errorf("topic invalid")
+	ErrTopicHandlerInvalid = fmt.Errorf("topic handler must be a function whose first parameter is the topic string")
+)
+
+// nodeTopicAddr 节点间发布订阅消息使用的保留目标地址，由节点而非服务处理
+const nodeTopicAddr int32 = math.MinInt32
+
+// 主题以 '.' 分隔层级，订阅时 '*' 匹配一个层级，'>' 匹配其后的一个或多个层级且只能位于末尾，例如：
+//
+//	"room.*.chat" 匹配 "room.1.chat"
+//	"room.>"      匹配 "room.1" 及 "room.1.chat"
+const (
+	topicSep          = "."
+	topicWildcardOne  = "*"
+	topicWildcardTail = ">"
+)
+
+// validTopic 检查主题或订阅模式是否合法，发布的主题不允许包含通配符
+func validTopic(topic string, pattern bool) bool {
+	if len(topic) == 0 {
+		return false
+	}
+	segs := strings.Split(topic, topicSep)
+	for i, seg := range segs {
+		if len(seg) == 0 {
+			return false
+		}
+		if seg == topicWildcardOne || seg == topicWildcardTail {
+			if !pattern || (seg == topicWildcardTail && i != len(segs)-1) {
+				return false
+			}
+			continue
+		}
+		if strings.ContainsAny(seg, topicWildcardOne+topicWildcardTail) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTopic 订阅模式是否匹配主题
+func matchTopic(pattern, topic string) bool {
+	for {
+		pSeg, pRest, pMore := strings.Cut(pattern, topicSep)
+		tSeg, tRest, tMore := strings.Cut(topic, topicSep)
+		switch {
+		case pSeg == topicWildcardTail:
+			return true
+		case pSeg != topicWildcardOne && pSeg != tSeg:
+			return false
+		case !pMore || !tMore:
+			return pMore == tMore
+		}
+		pattern, topic = pRest, tRest
+	}
+}
+
+// remoteInterest 远程节点的订阅模式，同一节点可能经由多条连接（双方各自发起）告知
+type remoteInterest struct {
+	patterns []string
+	addrs    []Addr
+}
+
+// pubsub 节点的发布订阅：维护本节点服务的订阅及远程节点的订阅模式，发布时向本节点匹配的服务及存在匹配订阅的节点各投递一次，
+// 投递不做重试与确认，最多一次，线程安全
+type pubsub struct {
+	node   *Node
+	lock   sync.RWMutex
+	local  map[string]map[*Service]struct{} // 订阅模式: 订阅的服务
+	remote map[string]*remoteInterest       // 节点名: 订阅模式
+}
+
+func newPubSub(node *Node) *pubsub {
+	return &pubsub{
+		node:   node,
+		local:  make(map[string]map[*Service]struct{}),
+		remote: make(map[string]*remoteInterest),
+	}
+}
+
+// subscribe 记录服务的订阅，本节点新增订阅模式时告知其他节点
+func (ss *pubsub) subscribe(pattern string, srv *Service) {
+	ss.lock.Lock()
+	set := ss.local[pattern]
+	if set == nil {
+		set = make(map[*Service]struct{})
+		ss.local[pattern] = set
+	}
+	set[srv] = struct{}{}
+	added := len(set) == 1
+	ss.lock.Unlock()
+
+	if added {
+		ss.announce()
+	}
+}
+
+// unsubscribe 移除服务的订阅，本节点不再有该订阅模式时告知其他节点
+func (ss *pubsub) unsubscribe(pattern string, srv *Service) {
+	ss.lock.Lock()
+	set := ss.local[pattern]
+	if _, ok := set[srv]; !ok {
+		ss.lock.Unlock()
+		return
+	}
+	delete(set, srv)
+	removed := len(set) == 0
+	if removed {
+		delete(ss.local, pattern)
+	}
+	ss.lock.Unlock()
+
+	if removed {
+		ss.announce()
+	}
+}
+
+// matchLocal 查找订阅了匹配主题的本节点服务
+func (ss *pubsub) matchLocal(topic string) []*Service {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	var services []*Service
+	for pattern, set := range ss.local {
+		if !matchTopic(pattern, topic) {
+			continue
+		}
+		for srv := range set {
+			if !slices.Contains(services, srv) {
+				services = append(services, srv)
+			}
+		}
+	}
+	return services
+}
+
+// matchRemote 查找存在匹配订阅的远程节点，每个节点返回一个连接地址
+func (ss *pubsub) matchRemote(topic string) []Addr {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	var addrs []Addr
+	for _, ri := range ss.remote {
+		if len(ri.addrs) == 0 {
+			continue
+		}
+		if slices.ContainsFunc(ri.patterns, func(p string) bool { return matchTopic(p, topic) }) {
+			addrs = append(addrs, ri.addrs[len(ri.addrs)-1])
+		}
+	}
+	return addrs
+}
+
+func (ss *pubsub) localPatterns() []string {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	patterns := make([]string, 0, len(ss.local))
+	for pattern := range ss.local {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	return patterns
+}
+
+// publish 向匹配的本节点服务及远程节点投递，src 为发布者；远程节点的订阅在节点启动时建立连接后获知
+func (ss *pubsub) publish(src *Service, topic string, trace int64, args []any) {
+	mc := src.node.regOpt.MetricCollector
+	if mc != nil {
+		mc.Counter("[PubSub] published "+topic, 1)
+	}
+
+	if services := ss.matchLocal(topic); len(services) > 0 {
+		vArgs := make([]reflect.Value, 0, len(args))
+		for _, arg := range args {
+			vArgs = append(vArgs, reflect.ValueOf(arg))
+		}
+		getter := func(ft reflect.Type) ([]reflect.Value, error) {
+			if ft.NumIn()-1 != len(vArgs) {
+				return nil, fmt.Errorf("topic handler expects %d args, got %d", ft.NumIn()-1, len(vArgs))
+			}
+			fArgs := make([]reflect.Value, 0, len(vArgs))
+			for i, arg := range vArgs {
+				if !arg.IsValid() {
+					arg = reflect.Zero(ft.In(i + 1))
+				}
+				fArgs = append(fArgs, arg)
+			}
+			return fArgs, nil
+		}
+		for _, srv := range services {
+			srv.deliverTopic(topic, trace, getter)
+		}
+	}
+
+	for _, nAddr := range ss.matchRemote(topic) {
+		sender := nodeGetMessageSender(nAddr, 0, false, nil)
+		if sender == nil || sender.closed() {
+			continue
+		}
+
+		m := &message{
+			src:   src.sAddr,
+			dst:   nodeTopicAddr,
+			trace: trace,
+			flag:  msgFlagPublish,
+		}
+		m.writeRequest(topic, args)
+		if sender.send(m) && mc != nil {
+			mc.Counter("[PubSub] forwarded "+topic, 1)
+		}
+	}
+}
+
+// announce 将本节点的全部订阅模式告知其他节点：已建立连接的节点，以及静态配置及服务发现中的节点；
+// 连接建立后对端同样告知其订阅，节点启动时调用以尽早获知其他节点的订阅
+func (ss *pubsub) announce() {
+	task.Execute(func() {
+		patterns := ss.localPatterns()
+		for _, nAddr := range ss.peers() {
+			if sender := nodeGetMessageSender(nAddr, 0, true, nil); sender != nil {
+				sender.send(newInterestMessage(patterns))
+			}
+		}
+	})
+}
+
+// onConnected 连接建立后告知对端本节点的订阅
+func (ss *pubsub) onConnected(h *remoteHandle) {
+	if ss == nil {
+		return
+	}
+	if patterns := ss.localPatterns(); len(patterns) > 0 {
+		h.send(newInterestMessage(patterns))
+	}
+}
+
+// onMembersChanged 服务发现成员变化后重新告知，新加入的节点由此获知本节点的订阅
+func (ss *pubsub) onMembersChanged() {
+	ss.announce()
+}
+
+// onHandleClosed 连接关闭后移除经由该连接获知的订阅
+func (ss *pubsub) onHandleClosed(nAddr Addr) {
+	if ss == nil {
+		return
+	}
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	for name, ri := range ss.remote {
+		ri.addrs = slices.DeleteFunc(ri.addrs, func(a Addr) bool { return a == nAddr })
+		if len(ri.addrs) == 0 {
+			delete(ss.remote, name)
+		}
+	}
+}
+
+// onMessage 处理远程节点发来的订阅变化或发布消息，于连接的接收线程中调用
+func (ss *pubsub) onMessage(h *remoteHandle, m *message) {
+	if ss == nil {
+		m.clear()
+		return
+	}
+
+	switch {
+	case m.flag&msgFlagInterest != 0:
+		defer m.clear()
+		name, err := m.getRequestFunc()
+		if err != nil {
+			return
+		}
+		lof, _ := m.getRequestFuncLen()
+		args, err := m.unmarshalArgs(m.data[messageHeaderLen+lof:], 0, reflect.TypeOf(func([]string) {}))
+		if err != nil {
+			slog.Warnf("node remote(%v) topic interest decode error: %v", h.nAddr, err)
+			return
+		}
+		ss.updateRemote(name, h.nAddr, args[0].Interface().([]string))
+	case m.flag&msgFlagPublish != 0:
+		topic, err := m.getRequestFunc()
+		if err != nil {
+			m.clear()
+			return
+		}
+		lof, _ := m.getRequestFuncLen()
+		bs := m.data[messageHeaderLen+lof:]
+		getter := func(ft reflect.Type) ([]reflect.Value, error) {
+			return m.unmarshalArgs(bs, 1, ft)
+		}
+		for _, srv := range ss.matchLocal(topic) {
+			srv.deliverTopic(topic, m.trace, getter)
+		}
+	default:
+		m.clear()
+	}
+}
+
+func (ss *pubsub) updateRemote(name string, nAddr Addr, patterns []string) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	ri := ss.remote[name]
+	if len(patterns) == 0 {
+		delete(ss.remote, name)
+		return
+	}
+	if ri == nil {
+		ri = &remoteInterest{}
+		ss.remote[name] = ri
+	}
+	ri.patterns = patterns
+	if !slices.Contains(ri.addrs, nAddr) {
+		ri.addrs = append(ri.addrs, nAddr)
+	}
+}
+
+func newInterestMessage(patterns []string) *message {
+	name := Config.CurNodeName
+	if len(name) == 0 {
+		name = Config.CurNodeAddr.String()
+	}
+
+	m := &message{
+		src:  nodeTopicAddr,
+		dst:  nodeTopicAddr,
+		flag: msgFlagInterest,
+	}
+	m.writeRequest(name, []any{patterns})
+	return m
+}
+
+// peers 需告知订阅的节点：已建立的连接、静态配置中的其他节点及服务发现成员
+func (ss *pubsub) peers() []Addr {
+	var peers []Addr
+	ss.node.Lock()
+	for nAddr, h := range ss.node.handle {
+		if !h.closed() {
+			peers = append(peers, nAddr)
+		}
+	}
+	d := ss.node.discovery
+	ss.node.Unlock()
+
+	add := func(nAddr Addr) {
+		if nAddr != Config.CurNodeAddr && !slices.Contains(peers, nAddr) {
+			peers = append(peers, nAddr)
+		}
+	}
+	for _, ni := range Config.Nodes {
+		if ni.Name != Config.CurNodeName && len(ni.Host) > 0 && ni.Port > 0 {
+			add(ni.NodeAddr)
+		}
+	}
+	if d != nil {
+		for _, nAddr := range d.addrs() {
+			add(nAddr)
+		}
+	}
+	return peers
+}
+
+// Subscribe 订阅主题，pattern 可包含通配符，f 的首个参数为实际的主题，其余参数为发布的参数，于服务主线程中回调，非线程安全
+//
+//	ss.Subscribe("room.*.chat", func(topic string, uid int64, text string) { ... })
+//
+// 同一模式重复订阅时替换回调，服务停止时自动取消全部订阅
+func (ss *Service) Subscribe(pattern string, f any) error {
+	if !validTopic(pattern, true) {
+		return ErrTopicInvalid
+	}
+	fv := reflect.ValueOf(f)
+	if fv.Kind() != reflect.Func || fv.Type().NumIn() == 0 || fv.Type().In(0).Kind() != reflect.String {
+		return ErrTopicHandlerInvalid
+	}
+
+	if ss.topics == nil {
+		ss.topics = make(map[string]reflect.Value)
+	}
+	ss.topics[pattern] = fv
+	if ps := ss.node.pubsub; ps != nil {
+		ps.subscribe(pattern, ss)
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅，非线程安全
+func (ss *Service) Unsubscribe(pattern string) {
+	if _, ok := ss.topics[pattern]; !ok {
+		return
+	}
+	delete(ss.topics, pattern)
+	if ps := ss.node.pubsub; ps != nil {
+		ps.unsubscribe(pattern, ss)
+	}
+}
+
+// Publish 发布消息至主题，本节点及其他节点上订阅了匹配模式的服务各收到一次，不保证送达，非线程安全
+func (ss *Service) Publish(topic string, args ...any) error {
+	if !validTopic(topic, false) {
+		return ErrTopicInvalid
+	}
+	ps := ss.node.pubsub
+	if ps == nil {
+		return nil
+	}
+
+	ps.publish(ss, topic, ss.traceOrNew(), args)
+	return nil
+}
+
+// unsubscribeAll 服务停止时取消全部订阅
+func (ss *Service) unsubscribeAll() {
+	for pattern := range ss.topics {
+		ss.Unsubscribe(pattern)
+	}
+}
+
+// deliverTopic 投递主题消息至服务主线程，依次调用匹配的订阅回调
+func (ss *Service) deliverTopic(topic string, trace int64, getter func(ft reflect.Type) ([]reflect.Value, error)) {
+	ss.fork("pubsub.deliver", func() {
+		mc := ss.node.regOpt.MetricCollector
+		for pattern, fv := range ss.topics {
+			if !matchTopic(pattern, topic) {
+				continue
+			}
+
+			args, err := getter(fv.Type())
+			if err != nil {
+				ss.Errorf("topic(%s) handler(%s) args error: %+v", topic, pattern, err)
+				if mc != nil {
+					mc.Counter("[PubSub] dropped "+topic, 1)
+				}
+				continue
+			}
+
+			ss.withTrace(trace, func() {
+				defer func() {
+					if e := recover(); e != nil {
+						ss.Errorf("topic(%s) handler(%s) got panic: %v => %v", topic, pattern, e, string(debug.Stack()))
+					}
+				}()
+				fv.Call(append([]reflect.Value{reflect.ValueOf(topic)}, args...))
+			})
+			if mc != nil {
+				mc.Counter("[PubSub] delivered "+topic, 1)
+			}
+		}
+	})
+}
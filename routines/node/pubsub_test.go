@@ -0,0 +1,193 @@
+package node
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mogud/snow/core/ticker"
+	"github.com/stretchr/testify/require"
+)
+
+func newPubSubTestServices(n int) ([]*Service, *testMetricCollector) {
+	srv, mc := newBreakerTestService()
+	node := srv.node
+	node.handle = map[Addr]*remoteHandle{}
+	node.pubsub = newPubSub(node)
+
+	services := []*Service{srv}
+	for i := 1; i < n; i++ {
+		services = append(services, &Service{node: node, logger: testLogger{}})
+	}
+	for i, s := range services {
+		s.sAddr = int32(i + 1)
+	}
+	return services, mc
+}
+
+func reencode(t *testing.T, m *message) *message {
+	bs, err := m.marshal()
+	require.NoError(t, err)
+	mm := &message{}
+	require.NoError(t, mm.unmarshal(bs))
+	return mm
+}
+
+func TestTopicMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"room.1.chat", "room.1.chat", true},
+		{"room.*.chat", "room.1.chat", true},
+		{"room.*.chat", "room.1.2.chat", false},
+		{"room.*", "room", false},
+		{"room.>", "room.1", true},
+		{"room.>", "room.1.chat", true},
+		{"room.>", "room", false},
+		{">", "room", true},
+		{"room", "room.1", false},
+	} {
+		require.Equal(t, c.match, matchTopic(c.pattern, c.topic), "%s %s", c.pattern, c.topic)
+	}
+
+	require.True(t, validTopic("room.*.>", true))
+	require.False(t, validTopic("room.*", false))
+	require.False(t, validTopic("room.>.chat", true))
+	require.False(t, validTopic("room..chat", true))
+	require.False(t, validTopic("room.a*", true))
+	require.False(t, validTopic("", true))
+}
+
+func TestPublishFansOutToLocalSubscribers(t *testing.T) {
+	services, mc := newPubSubTestServices(3)
+	pub, a, b := services[0], services[1], services[2]
+
+	var got []string
+	require.NoError(t, a.Subscribe("room.*.chat", func(topic string, uid int, text string) {
+		got = append(got, "a:"+topic+":"+text)
+	}))
+	require.NoError(t, a.Subscribe("room.>", func(topic string, uid int, text string) {
+		got = append(got, "a>:"+topic)
+	}))
+	require.NoError(t, b.Subscribe("room.2.chat", func(topic string, uid int, text string) {
+		got = append(got, "b:"+topic)
+	}))
+	require.Equal(t, ErrTopicHandlerInvalid, b.Subscribe("room", func(int) {}))
+	require.Equal(t, ErrTopicInvalid, b.Subscribe("room.>.x", func(string) {}))
+
+	require.NoError(t, pub.Publish("room.1.chat", 1, "hi"))
+	require.Equal(t, ErrTopicInvalid, pub.Publish("room.*.chat", 1, "hi"))
+	runForked(a)
+	runForked(b)
+	require.ElementsMatch(t, []string{"a:room.1.chat:hi", "a>:room.1.chat"}, got)
+
+	// 服务停止时取消全部订阅
+	got = nil
+	a.unsubscribeAll()
+	require.NoError(t, pub.Publish("room.2.chat", 2, "yo"))
+	runForked(a)
+	runForked(b)
+	require.Equal(t, []string{"b:room.2.chat"}, got)
+	require.Equal(t, []string{"room.2.chat"}, pub.node.pubsub.localPatterns())
+
+	require.Equal(t, uint64(2), mc.counters["[PubSub] published room.2.chat"]+mc.counters["[PubSub] published room.1.chat"])
+	require.Equal(t, uint64(2), mc.counters["[PubSub] delivered room.1.chat"])
+	require.Equal(t, uint64(1), mc.counters["[PubSub] delivered room.2.chat"])
+}
+
+func TestPublishFromRemoteNode(t *testing.T) {
+	services, _ := newPubSubTestServices(1)
+	srv := services[0]
+	ps := srv.node.pubsub
+
+	var got []string
+	require.NoError(t, srv.Subscribe("room.>", func(topic string, uid int, text string) {
+		got = append(got, topic+":"+text)
+	}))
+
+	nAddr, err := NewNodeAddr("127.0.0.1", 9001)
+	require.NoError(t, err)
+	h := &remoteHandle{node: srv.node, nAddr: nAddr}
+
+	// 远程节点告知订阅后，发布时匹配到该节点
+	ps.onMessage(h, reencode(t, newInterestMessage([]string{"rank.*"})))
+	require.Equal(t, []Addr{nAddr}, ps.matchRemote("rank.1"))
+	require.Empty(t, ps.matchRemote("room.1"))
+
+	m := &message{src: 1, dst: nodeTopicAddr, trace: 7, flag: msgFlagPublish}
+	m.writeRequest("room.1", []any{1, "hi"})
+	ps.onMessage(h, reencode(t, m))
+	runForked(srv)
+	require.Equal(t, []string{"room.1:hi"}, got)
+
+	ps.onHandleClosed(nAddr)
+	require.Empty(t, ps.matchRemote("rank.1"))
+}
+
+func TestPublishRightAfterStartupReachesRemoteSubscriber(t *testing.T) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+	port := listener.Addr().(*net.TCPAddr).Port
+	peerAddr, err := NewNodeAddr("127.0.0.1", port)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := ticker.NewPool("test.remote.handle", ctx, &sync.WaitGroup{}, 10, TickInterval)
+	pool.Start(func(item ticker.PoolItem) { item.(*remoteHandle).onTick() }, nil)
+
+	codecMap := map[string]ICodec{JsonCodec.Name(): JsonCodec}
+	gNode = &Node{
+		nodeOpt:                &Option{},
+		regOpt:                 &RegisterOption{},
+		codecs:                 []ICodec{JsonCodec},
+		codecMap:               codecMap,
+		chPreprocessor:         defaultHandlePreprocessor,
+		remoteHandleTickerPool: pool,
+		handle:                 make(map[Addr]*remoteHandle),
+		closeWait:              &sync.WaitGroup{},
+	}
+	gNode.pubsub = newPubSub(gNode)
+	gNode.discovery = newDiscovery(nil, &NodeEntry{Name: "Self"}, 0)
+	gNode.discovery.update([]*NodeEntry{{Name: "Peer", Host: "127.0.0.1", Port: port}})
+	pub := &Service{node: gNode, logger: testLogger{}, sAddr: 1}
+
+	// 节点启动时即连接其他节点，无需等待首次发布
+	gNode.pubsub.announce()
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	serverNode := &Node{nodeOpt: &Option{}, codecs: []ICodec{JsonCodec}, codecMap: codecMap}
+	_, err = serverNode.serverHandshake(conn)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	interest := &message{src: nodeTopicAddr, dst: nodeTopicAddr, flag: msgFlagInterest}
+	interest.writeRequest("Peer", []any{[]string{"room.>"}})
+	bs, err := interest.marshal()
+	require.NoError(t, err)
+	_, err = conn.Write(bs)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(gNode.pubsub.matchRemote("room.1")) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// 首次发布即投递至远程订阅者，且发布不再触发向其他节点的宣告
+	require.NoError(t, pub.Publish("room.1", 1, "hi"))
+	names := readRemoteRequestNames(t, conn, 2)
+	require.Equal(t, "room.1", names[1])
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	h := gNode.handle[peerAddr]
+	h.cancel()
+	_ = conn.Close()
+	gNode.closeWait.Wait()
+}
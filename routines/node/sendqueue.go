@@ -0,0 +1,112 @@
+package node
+
+import (
+	"fmt"
+)
+
+var ErrSendQueueFull = fmt.Errorf("remote send queue full")
+
+const (
+	defaultSendQueueSize = 8192
+	sendFrameQueueSize   = 64 // 已编码待写入连接的批次数，写入变慢时消息积压在发送队列中
+)
+
+// sendQueuePolicy 远端发送队列满时的处理策略
+type sendQueuePolicy int
+
+const (
+	sendQueueFail  sendQueuePolicy = iota // 调用立即以 ErrSendQueueFull 失败
+	sendQueueDrop                         // 丢弃队列中最早的投递为新消息腾出空间，无投递可丢弃时同 sendQueueFail
+	sendQueueBlock                        // 阻塞调用方服务直至队列有空间
+)
+
+func parseSendQueuePolicy(s string) (sendQueuePolicy, error) {
+	switch s {
+	case "", "Fail":
+		return sendQueueFail, nil
+	case "Drop":
+		return sendQueueDrop, nil
+	case "Block":
+		return sendQueueBlock, nil
+	}
+	return sendQueueFail, fmt.Errorf("invalid send queue policy: %v", s)
+}
+
+func (ss *remoteHandle) sendQueueSize() int {
+	if opt := ss.node.nodeOpt; opt != nil && opt.SendQueueSize > 0 {
+		return opt.SendQueueSize
+	}
+	return defaultSendQueueSize
+}
+
+// reserve 为消息预留发送队列空间，队列满时按策略阻塞、丢弃或返回错误；连接不可用时使用重连缓存上限
+func (ss *remoteHandle) reserve() error {
+	ss.wBufferLock.Lock()
+	defer ss.wBufferLock.Unlock()
+
+	blocked := false
+	for {
+		if ss.closed() {
+			return ErrRemoteDisconnected
+		}
+		if !ss.connected.Load() {
+			if len(ss.wBuffer) >= ss.bufferSize() {
+				return ErrRemoteBufferFull
+			}
+			return nil
+		}
+		if len(ss.wBuffer) < ss.sendQueueSize() {
+			return nil
+		}
+
+		switch ss.node.sendQueuePolicy {
+		case sendQueueBlock:
+			if !blocked {
+				blocked = true
+				ss.sendQueueMetric("blocked")
+			}
+			ss.wSpace.Wait()
+		case sendQueueDrop:
+			if !ss.dropOldestPost() {
+				ss.sendQueueMetric("rejected")
+				return ErrSendQueueFull
+			}
+			ss.sendQueueMetric("dropped")
+		default:
+			ss.sendQueueMetric("rejected")
+			return ErrSendQueueFull
+		}
+	}
+}
+
+// dropOldestPost 丢弃发送队列中最早的投递，须持有 wBufferLock
+func (ss *remoteHandle) dropOldestPost() bool {
+	for i, m := range ss.wBuffer {
+		if m != nil && m.sess == 0 {
+			ss.wBuffer = append(ss.wBuffer[:i], ss.wBuffer[i+1:]...)
+			m.clear()
+			return true
+		}
+	}
+	return false
+}
+
+func (ss *remoteHandle) metricCollector() IMetricCollector {
+	if ss.node.regOpt == nil {
+		return nil
+	}
+	return ss.node.regOpt.MetricCollector
+}
+
+func (ss *remoteHandle) sendQueueMetric(event string) {
+	if mc := ss.metricCollector(); mc != nil {
+		mc.Counter("[NodeSendQueue] "+event+" "+ss.nAddr.String(), 1)
+	}
+}
+
+func (ss *remoteHandle) sendQueueDepthMetric(depth int) {
+	if mc := ss.metricCollector(); mc != nil {
+		mc.Gauge("[NodeSendQueue] depth "+ss.nAddr.String(), int64(depth))
+		mc.Gauge("[NodeSendQueue] frames "+ss.nAddr.String(), int64(len(ss.wBuf)))
+	}
+}
@@ -0,0 +1,123 @@
+package node
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testMetricCollector struct {
+	lock       sync.Mutex
+	gauges     map[string]int64
+	counters   map[string]uint64
+	histograms []string // 记录过的直方图名
+}
+
+func (ss *testMetricCollector) Gauge(name string, val int64) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	ss.gauges[name] = val
+}
+
+func (ss *testMetricCollector) Counter(name string, val uint64) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	ss.counters[name] += val
+}
+
+func (ss *testMetricCollector) Histogram(name string, _ float64) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	ss.histograms = append(ss.histograms, name)
+}
+
+func newSendQueueTestHandle(policy sendQueuePolicy) (*remoteHandle, *testMetricCollector) {
+	mc := &testMetricCollector{gauges: map[string]int64{}, counters: map[string]uint64{}}
+	h := newRemoteHandle(&Node{
+		nodeOpt:         &Option{SendQueueSize: 2},
+		regOpt:          &RegisterOption{MetricCollector: mc},
+		sendQueuePolicy: policy,
+	}, Addr(101), nil)
+	h.applyHandshake(&handshakeResult{codec: JsonCodec})
+	h.connected.Store(true)
+	return h, mc
+}
+
+func newTestPost(fName string) *message {
+	m := &message{src: 1, dst: 2}
+	m.writeRequest(fName, nil)
+	return m
+}
+
+func TestSendQueueFailPolicyRejectsWhenFull(t *testing.T) {
+	h, mc := newSendQueueTestHandle(sendQueueFail)
+
+	var errs []error
+	require.True(t, h.send(newTestPost("post")))
+	require.True(t, h.send(newTestRequest(1, "first", func(m *message) { errs = append(errs, m.err) })))
+	require.False(t, h.send(newTestRequest(2, "second", func(m *message) { errs = append(errs, m.err) })))
+	require.Equal(t, []error{ErrSendQueueFull}, errs)
+
+	// 响应不受限制
+	rsp := &message{src: 2, dst: 1, sess: -1}
+	rsp.writeResponse()
+	require.True(t, h.send(rsp))
+	require.Len(t, h.wBuffer, 3)
+	require.Equal(t, uint64(1), mc.counters["[NodeSendQueue] rejected 0.0.0.0:101"])
+}
+
+func TestSendQueueDropPolicyDropsOldestPost(t *testing.T) {
+	h, _ := newSendQueueTestHandle(sendQueueDrop)
+
+	var errs []error
+	require.True(t, h.send(newTestPost("post")))
+	require.True(t, h.send(newTestRequest(1, "first", nil)))
+	require.True(t, h.send(newTestRequest(2, "second", func(m *message) { errs = append(errs, m.err) })))
+	require.Equal(t, []string{"first", "second"}, requestNames(t, h.wBuffer))
+
+	require.False(t, h.send(newTestRequest(3, "third", func(m *message) { errs = append(errs, m.err) })))
+	require.Equal(t, []error{ErrSendQueueFull}, errs)
+}
+
+func TestSendQueueBlockPolicyWaitsForSpace(t *testing.T) {
+	h, mc := newSendQueueTestHandle(sendQueueBlock)
+	require.True(t, h.send(newTestPost("first")))
+	require.True(t, h.send(newTestPost("second")))
+
+	sent := make(chan bool, 1)
+	go func() {
+		sent <- h.send(newTestPost("third"))
+	}()
+	select {
+	case <-sent:
+		t.Fatal("send should block while queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	h.onTick()
+	require.True(t, <-sent)
+	require.Len(t, h.wBuf, 1)
+	require.Equal(t, int64(2), mc.gauges["[NodeSendQueue] depth 0.0.0.0:101"])
+
+	h.wBufferLock.Lock()
+	defer h.wBufferLock.Unlock()
+	require.Equal(t, []string{"third"}, requestNames(t, h.wBuffer))
+}
+
+func TestSendQueueKeepsMessagesWhileFramesPending(t *testing.T) {
+	h, _ := newSendQueueTestHandle(sendQueueFail)
+	for range cap(h.wBuf) {
+		h.wBuf <- []byte{4, 0, 0, 0}
+	}
+
+	require.True(t, h.send(newTestPost("pending")))
+	h.onTick()
+	require.Equal(t, []string{"pending"}, requestNames(t, h.wBuffer))
+
+	<-h.wBuf
+	h.onTick()
+	require.Empty(t, h.wBuffer)
+	require.Len(t, h.wBuf, cap(h.wBuf))
+}
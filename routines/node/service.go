@@ -10,9 +10,11 @@ import (
 	"github.com/mogud/snow/core/ticker"
 	"github.com/valyala/fasthttp"
 	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -31,7 +33,7 @@ type iService interface {
 	Stop(wg *sync.WaitGroup)
 	// AfterStop 服务关闭后调用，此时任何消息都已关闭
 	AfterStop()
-	// Entry 用于自定义 RPC 处理
+	// Entry 用于自定义 RPC 处理，默认调用对应的 Rpc 方法，方法声明了返回值时以其结果自动响应
 	Entry(ctx IRpcContext, funcName string, argGetter func(ft reflect.Type) ([]reflect.Value, error)) func()
 
 	getService() *Service
@@ -57,6 +59,11 @@ type Service struct {
 	funcBuffer     []*tagFunc
 	msgBufferLock  sync.Mutex
 	msgBuffer      []*message
+	mailboxSize    int
+	mailboxPolicy  MailboxPolicy
+	supervisor     *SupervisorOption
+	panics         []int64 // 监督窗口内 panic 的时间
+	crashed        bool
 
 	nowNs           int64
 	tw              *timeWheel
@@ -72,6 +79,16 @@ type Service struct {
 	closedLock int32
 	wg         *sync.WaitGroup
 
+	curTrace int64 // 当前正在处理的调用链追踪 ID，原子读写
+	pausedNs int64 // 暂停开始的时间，0 代表未暂停，原子读写
+
+	coroutines map[*coroutine]struct{}
+	coCanceled bool
+
+	calls   map[callKey]*rpcContext // 已开始处理尚未响应的请求
+	streams map[callKey]*rpcStream
+	topics  map[string]reflect.Value // 订阅模式: 回调
+
 	metricNameFuncPrefix string
 }
 
@@ -85,7 +102,11 @@ func (ss *Service) AfterStop() {
 }
 
 func (ss *Service) Entry(ctx IRpcContext, funcName string, argGetter func(ft reflect.Type) ([]reflect.Value, error)) func() {
-	f := ss.methodMap[funcName]
+	f, ok := ss.methodMap[funcName]
+	if !ok {
+		ss.Errorf("doDispatch: method not found name = %v", funcName)
+		return nil
+	}
 	args, err := argGetter(f.Type())
 	if err != nil {
 		ss.Errorf("doDispatch: get args error: %+v name = %v", err, funcName)
@@ -93,7 +114,7 @@ func (ss *Service) Entry(ctx IRpcContext, funcName string, argGetter func(ft ref
 	}
 	fArgs := append([]reflect.Value{reflect.ValueOf(ss.realSrv), reflect.ValueOf(ctx)}, args...)
 	return func() {
-		f.Call(fArgs)
+		callRpcMethod(ctx, f, fArgs)
 
 		for _, arg := range fArgs {
 			if arg.CanAddr() {
@@ -113,11 +134,48 @@ func (ss *Service) Construct(logger *logging.Logger[Service]) {
 		data.Name = "*" + name
 		data.ID = fmt.Sprintf("%X", selfPtr)
 		data.Path = path
+		data.TraceID = atomic.LoadInt64(&ss.curTrace)
 	})
 }
 
+// Paused 服务是否已暂停，线程安全
 func (ss *Service) Paused() bool {
-	return false
+	return atomic.LoadInt64(&ss.pausedNs) != 0
+}
+
+// Pause 暂停服务，不再处理消息、Fork 的函数及定时器，期间到达的消息按邮箱策略排队，恢复后继续处理；
+// 在服务主线程中调用时，本帧尚未处理的消息及函数同样推迟到恢复后处理；返回是否由运行转为暂停，线程安全
+func (ss *Service) Pause() bool {
+	if !atomic.CompareAndSwapInt64(&ss.pausedNs, 0, time.Now().UnixNano()) {
+		return false
+	}
+	if atomic.LoadInt32(&ss.closedLock) != 0 {
+		// 已开始关闭的服务不再暂停
+		atomic.StoreInt64(&ss.pausedNs, 0)
+		return false
+	}
+
+	if mc := ss.node.regOpt.MetricCollector; mc != nil {
+		mc.Gauge("[ServicePaused] "+ss.name, 1)
+	}
+	ss.Infof("service paused")
+	return true
+}
+
+// Resume 恢复暂停的服务，暂停期间到期的定时器在恢复后依次触发；返回是否由暂停转为运行，线程安全
+func (ss *Service) Resume() bool {
+	pausedNs := atomic.SwapInt64(&ss.pausedNs, 0)
+	if pausedNs == 0 {
+		return false
+	}
+
+	dur := time.Now().UnixNano() - pausedNs
+	if mc := ss.node.regOpt.MetricCollector; mc != nil {
+		mc.Gauge("[ServicePaused] "+ss.name, 0)
+		mc.Histogram("[ServicePausedDuration] "+ss.name, float64(dur))
+	}
+	ss.Infof("service resumed after %v", time.Duration(dur))
+	return true
 }
 
 func (ss *Service) Closed() bool {
@@ -185,6 +243,11 @@ func (ss *Service) Fork(tag string, f func()) bool {
 	return ss.fork(tag, f)
 }
 
+// GetTraceID 获取当前正在处理的 RPC 或回调所属的调用链追踪 ID，不存在时返回 0，非线程安全
+func (ss *Service) GetTraceID() int64 {
+	return atomic.LoadInt64(&ss.curTrace)
+}
+
 // GetTime 获取当前时间，非线程安全
 func (ss *Service) GetTime() time.Time {
 	return time.Unix(0, ss.nowNs)
@@ -250,6 +313,27 @@ func (ss *Service) CreateProxyByUpdaterKind(nAddrUpdater *AddrUpdater, name stri
 	return ss.createProxy(nAddrUpdater, AddrInvalid, 0, name)
 }
 
+// CreateBalancedProxy 根据服务名创建在所有提供该服务的节点间负载均衡的代理，balancer 为空时使用轮询，线程安全
+func (ss *Service) CreateBalancedProxy(name string, balancer IBalancer) IBalancedProxy {
+	regInfo, ok := ss.node.name2Info[name]
+	if !ok {
+		ss.Errorf("[CreateBalancedProxy] invalid service name %v", name)
+		return nil
+	}
+	if balancer == nil {
+		balancer = NewRoundRobinBalancer()
+	}
+
+	return &balancedProxy{
+		srv:         ss,
+		name:        name,
+		sAddr:       -regInfo.Kind,
+		balancer:    balancer,
+		proxies:     make(map[Addr]*serviceProxy),
+		outstanding: make(map[Addr]int),
+	}
+}
+
 func (ss *Service) CreateHttpProxy(httpUrl, name string) IProxy {
 	// TODO by mogu: Golang HTTP2 有 bug，会导致超时访问，使用 HTTP1 可以绕过
 	tr := &http.Transport{}
@@ -330,7 +414,8 @@ func (ss *Service) init(node *Node, name string, kind int32, sAddr int32,
 func (ss *Service) afterInject() {
 }
 
-func (ss *Service) start(arg any) {
+// start 异步启动服务，done 非空时以 Start 的结果回调，回调不在服务主线程中执行
+func (ss *Service) start(arg any, done func(error)) {
 	ss.wg.Add(1)
 
 	ss.nowNs = time.Now().UnixNano()
@@ -340,7 +425,22 @@ func (ss *Service) start(arg any) {
 			ss.Debugf("start...")
 		}
 
-		ss.realSrv.Start(arg)
+		err := ss.callStart(arg)
+		if done != nil {
+			defer done(err)
+		}
+		if err != nil {
+			ss.wg.Done()
+			if ss.supervisor != nil {
+				ss.crashed = true
+				ss.node.supervisor.onCrash(ss, false)
+			} else {
+				// 未设置监督策略时不再重启，移除该实例，发往它的消息不会无限排队
+				ss.node.discardService(ss)
+				ss.Errorf("%v, instance discarded", err)
+			}
+			return
+		}
 
 		if isStandalone {
 			ss.Infof("start success")
@@ -359,6 +459,20 @@ func (ss *Service) start(arg any) {
 	})
 }
 
+// callStart 调用服务的 Start，panic 时返回包含 panic 值的 ErrServiceStartFailed
+func (ss *Service) callStart(arg any) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := debug.StackInfo()
+			ss.Errorf("service 'Start' execute error: %v\n%s", e, buf)
+			err = fmt.Errorf("%w: %v", ErrServiceStartFailed, e)
+		}
+	}()
+
+	ss.realSrv.Start(arg)
+	return nil
+}
+
 func (ss *Service) onTick() {
 	now := time.Now()
 	ss.nowNs = now.UnixNano()
@@ -370,7 +484,17 @@ func (ss *Service) onTick() {
 	ss.funcBufferLock.Unlock()
 
 	mc := ss.node.regOpt.MetricCollector
-	for _, f := range funcList {
+	if mc != nil {
+		mc.Gauge("[ServiceFuncQueue] "+ss.name, int64(len(funcList)))
+	}
+	for i, f := range funcList {
+		if ss.Paused() {
+			// 暂停时剩余的函数推迟到恢复后执行
+			ss.funcBufferLock.Lock()
+			ss.funcBuffer = append(funcList[i:], ss.funcBuffer...)
+			ss.funcBufferLock.Unlock()
+			return
+		}
 		if mc != nil {
 			start := time.Now().UnixNano()
 			ss.doFunc(f)
@@ -386,7 +510,17 @@ func (ss *Service) onTick() {
 	msgList := ss.msgBuffer
 	ss.msgBuffer = nil
 	ss.msgBufferLock.Unlock()
-	for _, msg := range msgList {
+	if mc != nil {
+		mc.Gauge("[ServiceMailbox] "+ss.name, int64(len(msgList)))
+	}
+	for i, msg := range msgList {
+		if ss.Paused() {
+			// 暂停时剩余的消息放回邮箱头部，恢复后按原顺序处理
+			ss.msgBufferLock.Lock()
+			ss.msgBuffer = append(msgList[i:], ss.msgBuffer...)
+			ss.msgBufferLock.Unlock()
+			return
+		}
 		ss.doDispatch(msg)
 	}
 }
@@ -400,6 +534,9 @@ func (ss *Service) stop() {
 		return
 	}
 
+	// 关闭流程需要服务主线程执行 Stop，暂停的服务先恢复
+	ss.Resume()
+
 	// 这里开始退出流程，当前还未处于关闭状态
 	isStandalone := Config.CurNodeMap[ss.name]
 	if isStandalone {
@@ -419,6 +556,9 @@ func (ss *Service) stop() {
 			ss.realSrv.Stop(wg)
 		}()
 
+		// 服务即将关闭，挂起的协程不会再被唤醒，订阅的主题不再投递
+		ss.cancelCoroutines()
+		ss.unsubscribeAll()
 		wg.Done()
 	})
 
@@ -503,9 +643,22 @@ func (ss *Service) send(msg *message) bool {
 		return false
 	}
 
-	ss.msgBufferLock.Lock()
-	defer ss.msgBufferLock.Unlock()
-	ss.msgBuffer = append(ss.msgBuffer, msg)
+	if msg != nil && msg.isControl() {
+		// 控制消息不受邮箱容量限制
+		if msg.flag&msgFlagCancel != 0 {
+			return ss.fork("rpc.cancel", func() {
+				ss.onCancel(msg)
+			})
+		}
+		return ss.fork("stream.control", func() {
+			ss.onStreamControl(msg)
+		})
+	}
+
+	if dropped := ss.pushMessage(msg); dropped != nil {
+		ss.rejectMessage(dropped, ErrMailboxFull)
+		return dropped != msg
+	}
 	return true
 }
 
@@ -514,6 +667,7 @@ func (ss *Service) doFunc(f *tagFunc) {
 		if err := recover(); err != nil {
 			buf := debug.StackInfo()
 			ss.Errorf("service execute function(%v) error: %v\n%s", f.Tag, err, buf)
+			ss.onPanic(err)
 		}
 		f.F = nil
 	}()
@@ -522,6 +676,7 @@ func (ss *Service) doFunc(f *tagFunc) {
 
 func (ss *Service) doDispatch(mReq *message) {
 	var funcName string
+	var ctx *rpcContext
 	defer func() {
 		mReq.clear()
 
@@ -532,6 +687,11 @@ func (ss *Service) doDispatch(mReq *message) {
 			} else {
 				ss.Errorf("service execute function %s error: %v\n%s", funcName, err, buf)
 			}
+			// 尚未响应的请求以错误响应，并结束跟踪
+			if ctx != nil {
+				ctx.Error(ErrRpcHandlerPanic)
+			}
+			ss.onPanic(err)
 		}
 	}()
 
@@ -542,6 +702,15 @@ func (ss *Service) doDispatch(mReq *message) {
 		return
 	}
 
+	if mReq.deadline > 0 && time.Now().UnixNano() > mReq.deadline {
+		// 调用方已放弃等待，不再执行
+		if mc := ss.node.regOpt.MetricCollector; mc != nil {
+			mc.Counter("[ServiceRpc] expired "+ss.name, 1)
+		}
+		ss.replyError(mReq, ErrRequestTimeoutRemote)
+		return
+	}
+
 	mRsp := &message{
 		nAddr: mReq.nAddr,
 		src:   ss.sAddr,
@@ -550,51 +719,108 @@ func (ss *Service) doDispatch(mReq *message) {
 		trace: mReq.trace,
 	}
 
-	if mc := ss.node.regOpt.MetricCollector; mc != nil {
-		mc.Counter("[ServiceRpc] "+ss.name, 1)
+	isRequest := mReq.sess != 0
+	mc := ss.node.regOpt.MetricCollector
+	se := ss.node.regOpt.SpanExporter
+
+	var start time.Time
+	var flushCb func(err error)
+	if mc != nil || se != nil {
+		start = time.Now()
+		if mc != nil {
+			mc.Counter("[ServiceRpc] "+ss.name, 1)
+		}
 
-		start := time.Now().UnixNano()
-		var cb func()
-		isRequest := mReq.sess != 0
 		if isRequest {
-			cb = func() {
+			flushCb = func(err error) {
 				// request
-				dur := time.Now().UnixNano() - start
-				mc.Histogram("[ServiceRequest] "+ss.name+"::"+funcName, float64(dur))
+				dur := time.Since(start)
+				if mc != nil {
+					mc.Histogram("[ServiceRequest] "+ss.name+"::"+funcName, float64(dur))
+				}
+				if se != nil {
+					ss.exportSpan(se, SpanKindRpc, funcName, mReq.trace, mReq.nAddr, start, dur, err)
+				}
 			}
 		}
+	}
 
-		ctx := newRpcContext(ss, mRsp, mReq.sess, mReq.src, mReq.nAddr, mReq.cb, cb)
+	ctx = newRpcContext(ss, mRsp, mReq.sess, mReq.src, mReq.nAddr, mReq.peer, mReq.cb, flushCb)
+	ctx.deadline = mReq.deadline
+	if isRequest {
+		ss.trackCall(ctx)
+	}
+	if isRequest && mReq.flag&msgFlagStream != 0 {
+		ss.openStream(ctx, mReq)
+	}
+	ss.withTrace(mReq.trace, func() {
 		if ss.delayedRpc == nil || ss.allowedRpc[funcName] {
 			ss.entry(ctx, funcName, mReq.getRequestFuncArgs)
 		} else {
 			ss.delayEntry(ctx, funcName, mReq.getRequestFuncArgs)
 		}
+	})
 
-		if !isRequest {
-			dur := time.Now().UnixNano() - start
+	if !isRequest && (mc != nil || se != nil) {
+		dur := time.Since(start)
+		if mc != nil {
 			mc.Histogram("[ServicePost] "+ss.name+"::"+funcName, float64(dur))
 		}
-	} else {
-		ctx := newRpcContext(ss, mRsp, mReq.sess, mReq.src, mReq.nAddr, mReq.cb, nil)
-		if ss.delayedRpc == nil || ss.allowedRpc[funcName] {
-			ss.entry(ctx, funcName, mReq.getRequestFuncArgs)
-		} else {
-			ss.delayEntry(ctx, funcName, mReq.getRequestFuncArgs)
+		if se != nil {
+			ss.exportSpan(se, SpanKindPost, funcName, mReq.trace, mReq.nAddr, start, dur, nil)
 		}
 	}
 }
 
+// withTrace 在指定调用链追踪 ID 下执行 f，须在服务主线程调用
+func (ss *Service) withTrace(trace int64, f func()) {
+	old := atomic.SwapInt64(&ss.curTrace, trace)
+	defer atomic.StoreInt64(&ss.curTrace, old)
+	f()
+}
+
+func (ss *Service) exportSpan(se ISpanExporter, kind, method string, trace int64, remote Addr, start time.Time, dur time.Duration, err error) {
+	span := &Span{
+		TraceID:  logging.FormatTraceID(trace),
+		Node:     Config.CurNodeName,
+		Service:  ss.name,
+		Method:   method,
+		Kind:     kind,
+		Start:    start,
+		Duration: dur,
+	}
+	if remote != AddrLocal {
+		span.Remote = remote.String()
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+	se.Export(span)
+}
+
 func (ss *Service) delayEntry(ctx IRpcContext, funcName string, argGetter func(ft reflect.Type) ([]reflect.Value, error)) {
-	if f := ss.realSrv.Entry(ctx, funcName, argGetter); f != nil {
-		ss.delayedRpc = append(ss.delayedRpc, f)
+	f := ss.realSrv.Entry(ctx, funcName, argGetter)
+	if f == nil {
+		ctx.Error(ErrRpcBadRequest)
+		return
 	}
+	trace := ss.GetTraceID()
+	ss.delayedRpc = append(ss.delayedRpc, func() {
+		if ctx.Canceled() {
+			return
+		}
+		ss.withTrace(trace, f)
+	})
 }
 
 func (ss *Service) entry(ctx IRpcContext, funcName string, argGetter func(ft reflect.Type) ([]reflect.Value, error)) {
-	if f := ss.realSrv.Entry(ctx, funcName, argGetter); f != nil {
-		f()
+	f := ss.realSrv.Entry(ctx, funcName, argGetter)
+	if f == nil {
+		// 方法不存在或参数错误，调用方无需等待至超时
+		ctx.Error(ErrRpcBadRequest)
+		return
 	}
+	f()
 }
 
 func (ss *Service) handleHttpRpc(ctx *fasthttp.RequestCtx) {
@@ -679,7 +905,7 @@ func (ss *Service) createProxy(updater *AddrUpdater, nAddr Addr, sAddr int32, na
 								if ni.UseHttps {
 									protocol = "https"
 								}
-								urlBase = fmt.Sprintf("%v://%s:%v", protocol, ni.Host, ni.HttpPort)
+								urlBase = fmt.Sprintf("%v://%s", protocol, net.JoinHostPort(ni.Host, strconv.Itoa(ni.HttpPort)))
 								break loop
 							} else if ni.Port > 0 {
 								nAddr = ni.NodeAddr
@@ -688,6 +914,17 @@ func (ss *Service) createProxy(updater *AddrUpdater, nAddr Addr, sAddr int32, na
 						}
 					}
 				}
+
+				// 静态配置中不存在时通过注册中心动态查找，每次调用时解析，成员变化后自动切换
+				if len(urlBase) == 0 && nAddr == AddrInvalid && ss.node.discovery != nil {
+					return &serviceProxy{
+						srv:       ss,
+						nAddr:     AddrInvalid,
+						sAddr:     sAddr,
+						discovery: ss.node.discovery,
+						name:      name,
+					}
+				}
 			}
 		}
 	}
@@ -762,7 +999,13 @@ func processHttpRpc(srv *Service, ctx *fasthttp.RequestCtx) {
 	if !hc.Post {
 		ch = make(chan *httpResponse, 1)
 	}
-	httpRpcCtx := newHttpRpcContext(ch)
+
+	// 调用方未携带追踪 ID 时开启新的调用链
+	trace := orNewTraceID(parseTraceID(string(ctx.Request.Header.Peek(httpTraceHeader))))
+	start := time.Now()
+	se := srv.node.regOpt.SpanExporter
+
+	httpRpcCtx := newHttpRpcContext(ch, trace)
 	rArgs := make([]reflect.Value, 0, ft.NumIn())
 	rArgs = append(rArgs, reflect.ValueOf(srv.realSrv))
 	rArgs = append(rArgs, reflect.ValueOf(IRpcContext(httpRpcCtx)))
@@ -775,14 +1018,21 @@ func processHttpRpc(srv *Service, ctx *fasthttp.RequestCtx) {
 			if r := recover(); r != nil && ch != nil {
 				srv.Errorf("handle httpRpc(%v) failed\n%v", hc.Func, debug.StackInfo())
 
-				ch <- &httpResponse{
-					StatusCode: http.StatusInternalServerError,
-					Result:     jsoniter.RawMessage(fmt.Sprintf("internal game logic error")),
+				if !httpRpcCtx.responded {
+					ch <- &httpResponse{
+						StatusCode: http.StatusInternalServerError,
+						Result:     jsoniter.RawMessage(fmt.Sprintf("internal game logic error")),
+					}
 				}
 			}
 		}()
 
-		f.Call(rArgs)
+		srv.withTrace(trace, func() {
+			// panic 时由上方以 StatusInternalServerError 响应
+			if outs := f.Call(rArgs); len(outs) > 0 {
+				replyResults(httpRpcCtx, outs)
+			}
+		})
 
 		for _, arg := range rArgs {
 			if arg.CanAddr() {
@@ -790,11 +1040,23 @@ func processHttpRpc(srv *Service, ctx *fasthttp.RequestCtx) {
 			}
 		}
 		rArgs = nil
+
+		if ch == nil && se != nil {
+			srv.exportSpan(se, SpanKindHttp, hc.Func, trace, AddrLocal, start, time.Since(start), nil)
+		}
 	})
 
 	if ch != nil {
 		rsp := <-ch
 
+		if se != nil {
+			var rspErr error
+			if rsp.StatusCode != http.StatusOK {
+				rspErr = fmt.Errorf("http status(%v): %s", rsp.StatusCode, string(rsp.Result))
+			}
+			srv.exportSpan(se, SpanKindHttp, hc.Func, trace, AddrLocal, start, time.Since(start), rspErr)
+		}
+
 		if rsp.StatusCode != http.StatusOK {
 			ctx.Error(string(rsp.Result), rsp.StatusCode)
 			return
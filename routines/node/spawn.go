@@ -0,0 +1,388 @@
+package node
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mogud/snow/core/task"
+)
+
+var (
+	ErrNodeNotFound         = fmt.Errorf("node not found")
+	ErrNoSpawnNode          = fmt.Errorf("no node available to spawn service")
+	ErrServiceNotSpawned    = fmt.Errorf("service not spawned by node manager")
+	ErrSpawnCallbackInvalid = fmt.Errorf("spawn callback must be func(IProxy)")
+	ErrSpawnUnauthorized    = fmt.Errorf("node manager token mismatch")
+)
+
+// 内置的节点管理服务，每个节点自动创建，负责为其他节点创建及关闭服务实例
+const (
+	nodeManagerName       = "NodeManager"
+	nodeManagerKind int32 = math.MaxInt32
+)
+
+// spawnLoadTimeout 未指定超时时按负载选择节点查询各节点的超时
+const spawnLoadTimeout = 3 * time.Second
+
+func nodeManagerRegisterInfo() *ServiceRegisterInfo {
+	return &ServiceRegisterInfo{
+		Kind: nodeManagerKind,
+		Name: nodeManagerName,
+		Type: reflect.TypeFor[*nodeManager](),
+	}
+}
+
+// SpawnArg 远程创建的服务在 Start 中收到的参数，即 SpawnService 的 arg 以 JSON 编码后的数据，与编解码器协商结果无关
+type SpawnArg []byte
+
+// Decode 将参数解码至 v
+func (ss SpawnArg) Decode(v any) error {
+	return jsoniter.Unmarshal(ss, v)
+}
+
+type nodeManager struct {
+	Service
+
+	spawned map[int32]string // 由当前节点管理服务创建的实例
+}
+
+func (ss *nodeManager) Start(_ any) {
+	ss.spawned = make(map[int32]string)
+	if len(ss.node.nodeOpt.RegistryToken) == 0 {
+		ss.Warnf("node manager has no RegistryToken, any peer reaching the node can spawn or stop services")
+	}
+	ss.EnableRpc()
+}
+
+// authorize 校验调用方携带的 RegistryToken
+func (ss *nodeManager) authorize(token string) error {
+	if !tokenMatches([]byte(token), ss.node.nodeOpt.RegistryToken) {
+		return ErrSpawnUnauthorized
+	}
+	return nil
+}
+
+// Stop 节点关闭时一并关闭创建的实例
+func (ss *nodeManager) Stop(wg *sync.WaitGroup) {
+	for sAddr := range ss.spawned {
+		wg.Add(1)
+		task.Execute(func() {
+			defer wg.Done()
+			StopService(sAddr)
+		})
+	}
+	ss.spawned = nil
+}
+
+// RpcSpawn 创建服务 name 的新实例并以 arg 启动，Start 返回后响应其服务地址，Start panic 时响应错误
+func (ss *nodeManager) RpcSpawn(ctx IRpcContext, token, name string, arg []byte) {
+	if err := ss.authorize(token); err != nil {
+		ctx.Error(err)
+		return
+	}
+	if name == nodeManagerName {
+		ctx.Error(fmt.Errorf("service(%s) cannot be spawned", name))
+		return
+	}
+	sAddr, err := newService(name, false)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ss.spawned[sAddr] = name
+	startService(sAddr, SpawnArg(arg), func(err error) {
+		ss.Fork("nodeManager.spawned", func() {
+			if err != nil {
+				delete(ss.spawned, sAddr)
+				ss.Errorf("service(%s:%#8x) spawn failed: %v", name, sAddr, err)
+				ctx.Error(err)
+				return
+			}
+			ss.Infof("service(%s:%#8x) spawned", name, sAddr)
+			ctx.Return(sAddr)
+		})
+	})
+}
+
+// RpcStop 关闭由 RpcSpawn 创建的实例，关闭完成后响应
+func (ss *nodeManager) RpcStop(ctx IRpcContext, token string, sAddr int32) {
+	if err := ss.authorize(token); err != nil {
+		ctx.Error(err)
+		return
+	}
+	name, ok := ss.spawned[sAddr]
+	if !ok {
+		ctx.Error(ErrServiceNotSpawned)
+		return
+	}
+	delete(ss.spawned, sAddr)
+
+	// 关闭服务会阻塞至其主线程结束，不在当前服务主线程中等待
+	task.Execute(func() {
+		StopService(sAddr)
+		ss.Fork("nodeManager.stopped", func() {
+			ss.Infof("service(%s:%#8x) stopped", name, sAddr)
+			ctx.Return()
+		})
+	})
+}
+
+// RpcLoad 当前节点由 RpcSpawn 创建且仍在运行的实例数，当前节点未注册服务 name 时返回错误
+func (ss *nodeManager) RpcLoad(_ IRpcContext, token, name string) (int, error) {
+	if err := ss.authorize(token); err != nil {
+		return 0, err
+	}
+	if ss.node.name2Info[name] == nil || name == nodeManagerName {
+		return 0, fmt.Errorf("service proto kind(%s) is not registered", name)
+	}
+	for sAddr := range ss.spawned {
+		if nodeGetService(sAddr) == nil {
+			delete(ss.spawned, sAddr)
+		}
+	}
+	return len(ss.spawned), nil
+}
+
+// SpawnService 在名为 nodeName 的节点上创建服务 name 的新实例，arg 编码为 SpawnArg 后作为其 Start 的参数；
+// nodeName 为空时在可创建该服务的节点中选择已创建实例最少的节点。Then 回调 func(IProxy)，代理指向新实例，非线程安全
+func (ss *Service) SpawnService(nodeName, name string, arg any) IPromise {
+	return newPromise(&spawnProxy{srv: ss, nodeName: nodeName}, "Spawn", []any{name, arg})
+}
+
+// StopSpawnedService 关闭由 SpawnService 创建的实例，proxy 为 SpawnService 回调的代理，关闭完成后回调 Then，非线程安全
+func (ss *Service) StopSpawnedService(proxy IProxy) IPromise {
+	return newPromise(&spawnProxy{srv: ss}, "Stop", []any{proxy})
+}
+
+var _ = iProxy((*spawnProxy)(nil))
+
+// spawnProxy 经由目标节点的节点管理服务完成 SpawnService 及 StopSpawnedService，回调均在服务主线程执行
+type spawnProxy struct {
+	srv      *Service
+	nodeName string
+}
+
+func (ss *spawnProxy) Call(fName string, args ...any) IPromise {
+	return newPromise(ss, fName, args)
+}
+
+func (ss *spawnProxy) GetNodeAddr() INodeAddr {
+	return AddrInvalid
+}
+
+func (ss *spawnProxy) Avail() bool {
+	return true
+}
+
+func (ss *spawnProxy) getService() *Service {
+	return ss.srv
+}
+
+func (ss *spawnProxy) doCall(p *promise) {
+	if p.trace == 0 {
+		p.trace = ss.srv.traceOrNew()
+	}
+
+	switch p.fName {
+	case "Spawn":
+		ss.spawn(p)
+	case "Stop":
+		ss.stop(p)
+	}
+}
+
+func (ss *spawnProxy) spawn(p *promise) {
+	name, arg := p.args[0].(string), p.args[1]
+
+	then := func(IProxy) {}
+	if p.successCb != nil {
+		var ok bool
+		if then, ok = p.successCb.(func(IProxy)); !ok {
+			ss.reject(p, ErrSpawnCallbackInvalid)
+			return
+		}
+	}
+
+	var data []byte
+	if arg != nil {
+		var err error
+		if data, err = jsoniter.Marshal(arg); err != nil {
+			ss.reject(p, err)
+			return
+		}
+	}
+
+	spawnOn := func(nAddr Addr) {
+		q := ss.call(p, nAddr, "Spawn", name, data)
+		q.successCb = func(sAddr int32) {
+			then(ss.srv.CreateProxyByNodeAddr(nAddr, sAddr))
+		}
+		ss.forward(p, q)
+		q.Done()
+	}
+
+	if len(ss.nodeName) > 0 {
+		nAddr := ss.srv.node.nodeAddrByName(ss.nodeName)
+		if nAddr == AddrInvalid {
+			ss.reject(p, ErrNodeNotFound)
+			return
+		}
+		spawnOn(nAddr)
+		return
+	}
+
+	// 查询各节点负载，全部返回后选择实例最少的节点，负载相同时按查询顺序优先
+	nodes := ss.srv.node.spawnCandidates()
+	loads := make([]int, len(nodes))
+	calls := make([]*promise, 0, len(nodes))
+	pending := len(nodes)
+	canceled := false
+	p.cancel = func() {
+		canceled = true
+		for _, q := range calls {
+			q.Cancel()
+		}
+	}
+	for i, nAddr := range nodes {
+		loads[i] = -1
+		q := ss.call(p, nAddr, "Load", name)
+		if q.timeout == -1 {
+			q.timeout = spawnLoadTimeout
+		}
+		q.successCb = func(load int) {
+			loads[i] = load
+		}
+		q.errCb = func(error) {}
+		q.finalCb = func() {
+			if pending--; pending > 0 {
+				return
+			}
+			p.cancel = nil
+			if canceled {
+				ss.reject(p, ErrRequestCanceled)
+				return
+			}
+
+			best := -1
+			for j, load := range loads {
+				if load >= 0 && (best < 0 || load < loads[best]) {
+					best = j
+				}
+			}
+			if best < 0 {
+				ss.reject(p, ErrNoSpawnNode)
+				return
+			}
+			spawnOn(nodes[best])
+		}
+		calls = append(calls, q)
+	}
+	for _, q := range calls {
+		q.Done()
+	}
+}
+
+func (ss *spawnProxy) stop(p *promise) {
+	sp, ok := p.args[0].(*serviceProxy)
+	if !ok || sp.sAddr <= 0 {
+		ss.reject(p, ErrServiceNotSpawned)
+		return
+	}
+
+	q := ss.call(p, sp.nAddr, "Stop", sp.sAddr)
+	q.successCb = p.successCb
+	if q.successCb == nil {
+		q.successCb = _emptyThen
+	}
+	ss.forward(p, q)
+	q.Done()
+}
+
+// call 创建对节点 nAddr 上节点管理服务的调用，携带当前节点的 RegistryToken，沿用 p 的追踪 ID 及超时
+func (ss *spawnProxy) call(p *promise, nAddr Addr, fName string, args ...any) *promise {
+	args = append([]any{ss.srv.node.nodeOpt.RegistryToken}, args...)
+	q := newPromise(ss.srv.CreateProxyByNodeAddr(nAddr, -nodeManagerKind).(iProxy), fName, args)
+	q.trace = p.trace
+	q.timeout = p.timeout
+	return q
+}
+
+// forward 以 q 的结果结束 p
+func (ss *spawnProxy) forward(p, q *promise) {
+	q.errCb = p.errCb
+	q.finalCb = func() {
+		if p.finalCb != nil {
+			p.finalCb()
+		}
+		p.clear()
+	}
+	p.cancel = q.Cancel
+}
+
+// reject 以 err 结束 p
+func (ss *spawnProxy) reject(p *promise, err error) {
+	srv := ss.srv
+	srv.Fork("spawn.err.cb", func() {
+		srv.withTrace(p.trace, func() {
+			if p.errCb != nil {
+				p.errCb(err)
+			} else {
+				srv.Errorf("%s service uncatched error: %+v", p.fName, err)
+			}
+		})
+		if p.finalCb != nil {
+			p.finalCb()
+		}
+		p.clear()
+	})
+}
+
+// nodeAddrByName 按节点名依次在当前节点、Nodes 配置及服务发现的成员中查找节点地址，不存在时返回 AddrInvalid
+func (ss *Node) nodeAddrByName(name string) Addr {
+	if name == Config.CurNodeName {
+		return AddrLocal
+	}
+	for _, ni := range Config.Nodes {
+		if ni.Name == name {
+			return ni.NodeAddr
+		}
+	}
+
+	ss.Lock()
+	d := ss.discovery
+	ss.Unlock()
+	if d != nil {
+		return d.lookupNode(name)
+	}
+	return AddrInvalid
+}
+
+// spawnCandidates 可创建服务的节点：当前节点、Nodes 配置中的其他节点及服务发现的成员
+func (ss *Node) spawnCandidates() []Addr {
+	nodes := []Addr{AddrLocal}
+	add := func(nAddr Addr) {
+		if nAddr != Config.CurNodeAddr && !slices.Contains(nodes, nAddr) {
+			nodes = append(nodes, nAddr)
+		}
+	}
+	for _, ni := range Config.Nodes {
+		if ni.Name != Config.CurNodeName && len(ni.Host) > 0 && ni.Port > 0 {
+			add(ni.NodeAddr)
+		}
+	}
+
+	ss.Lock()
+	d := ss.discovery
+	ss.Unlock()
+	if d != nil {
+		for _, nAddr := range d.addrs() {
+			add(nAddr)
+		}
+	}
+	return nodes
+}
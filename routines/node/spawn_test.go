@@ -0,0 +1,130 @@
+package node
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type spawnTestManager struct {
+	Service
+	args    []map[string]int
+	stopped []int32
+	tokens  []string
+}
+
+func (ss *spawnTestManager) RpcLoad(_ IRpcContext, token, name string) (int, error) {
+	ss.tokens = append(ss.tokens, token)
+	return len(ss.args), nil
+}
+
+func (ss *spawnTestManager) RpcSpawn(_ IRpcContext, token, name string, arg []byte) (int32, error) {
+	ss.tokens = append(ss.tokens, token)
+	var m map[string]int
+	if err := SpawnArg(arg).Decode(&m); err != nil {
+		return 0, err
+	}
+	ss.args = append(ss.args, m)
+	return int32(100 + len(ss.args)), nil
+}
+
+func (ss *spawnTestManager) RpcStop(_ IRpcContext, token string, sAddr int32) error {
+	ss.tokens = append(ss.tokens, token)
+	ss.stopped = append(ss.stopped, sAddr)
+	return nil
+}
+
+func newSpawnTestPair(t *testing.T) (*Service, *spawnTestManager) {
+	caller, _ := newPolicyTestService()
+	caller.sAddr = 1
+	caller.node.nodeOpt = &Option{RegistryToken: "secret"}
+
+	mgr := &spawnTestManager{}
+	mgr.node = caller.node
+	mgr.logger = testLogger{}
+	mgr.tw = caller.tw
+	mgr.sAddr = 2
+	mgr.realSrv = mgr
+	mgr.methodMap = map[string]reflect.Value{}
+	st := reflect.TypeOf(mgr)
+	for i := 0; i < st.NumMethod(); i++ {
+		m := st.Method(i)
+		if name, ok := strings.CutPrefix(m.Name, "Rpc"); ok {
+			mgr.methodMap[name] = m.Func
+		}
+	}
+
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+	gNode = caller.node
+	gNode.services = map[int32]*Service{-nodeManagerKind: &mgr.Service}
+	return caller, mgr
+}
+
+// pumpSpawn 交替处理节点管理服务的请求及调用方的回调直至无事可做
+func pumpSpawn(caller *Service, mgr *spawnTestManager) {
+	for len(caller.funcBuffer) > 0 || len(mgr.msgBuffer) > 0 {
+		mgr.onTick()
+		runForked(caller)
+	}
+}
+
+func TestSpawnServiceByLoad(t *testing.T) {
+	caller, mgr := newSpawnTestPair(t)
+
+	var proxies []IProxy
+	finals := 0
+	for i := range 2 {
+		caller.SpawnService("", "Room", map[string]int{"id": i}).
+			Then(func(proxy IProxy) { proxies = append(proxies, proxy) }).
+			Catch(func(err error) { t.Error(err) }).
+			Final(func() { finals++ }).Done()
+		pumpSpawn(caller, mgr)
+	}
+	require.Equal(t, []map[string]int{{"id": 0}, {"id": 1}}, mgr.args)
+	require.Equal(t, 2, finals)
+	require.Len(t, proxies, 2)
+	require.Equal(t, int32(102), proxies[1].(*serviceProxy).sAddr)
+	require.Equal(t, AddrLocal, proxies[1].GetNodeAddr())
+
+	stopped := false
+	caller.StopSpawnedService(proxies[0]).Then(func() { stopped = true }).Done()
+	pumpSpawn(caller, mgr)
+	require.True(t, stopped)
+	require.Equal(t, []int32{101}, mgr.stopped)
+
+	// 每次调用均携带当前节点的令牌
+	require.NotEmpty(t, mgr.tokens)
+	for _, token := range mgr.tokens {
+		require.Equal(t, "secret", token)
+	}
+}
+
+func TestNodeManagerRejectsWrongToken(t *testing.T) {
+	mgr := &nodeManager{spawned: map[int32]string{}}
+	mgr.node = &Node{nodeOpt: &Option{RegistryToken: "secret"}, name2Info: map[string]*ServiceRegisterInfo{}}
+
+	_, err := mgr.RpcLoad(nil, "forged", "Room")
+	require.ErrorIs(t, err, ErrSpawnUnauthorized)
+	_, err = mgr.RpcLoad(nil, "", "Room")
+	require.ErrorIs(t, err, ErrSpawnUnauthorized)
+
+	// 令牌正确时才检查服务是否注册
+	_, err = mgr.RpcLoad(nil, "secret", "Room")
+	require.ErrorContains(t, err, "not registered")
+}
+
+func TestSpawnServiceErrors(t *testing.T) {
+	caller, mgr := newSpawnTestPair(t)
+
+	var errs []error
+	catch := func(err error) { errs = append(errs, err) }
+	caller.SpawnService("Missing", "Room", nil).Then(func(IProxy) {}).Catch(catch).Done()
+	caller.SpawnService("", "Room", nil).Then(func(int32) {}).Catch(catch).Done()
+	caller.StopSpawnedService(&testProxy{}).Then(func() {}).Catch(catch).Done()
+	pumpSpawn(caller, mgr)
+	require.Equal(t, []error{ErrNodeNotFound, ErrSpawnCallbackInvalid, ErrServiceNotSpawned}, errs)
+	require.Empty(t, mgr.args)
+}
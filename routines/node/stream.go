@@ -0,0 +1,439 @@
+package node
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	ErrStreamFull         = fmt.Errorf("stream buffer full")
+	ErrStreamClosed       = fmt.Errorf("stream closed")
+	ErrStreamCanceled     = fmt.Errorf("stream canceled")
+	ErrStreamNotSupported = fmt.Errorf("stream not supported by proxy")
+)
+
+const (
+	defaultStreamWindow  = 32
+	defaultStreamTimeout = 30 * time.Second
+)
+
+var _ IRpcStream = (*rpcStream)(nil)
+
+// rpcStream 被调用方的流，调用方每消费一批消息后增加窗口，窗口用尽时消息缓存在本地，非线程安全
+type rpcStream struct {
+	ctx     *rpcContext
+	key     callKey
+	window  int
+	credit  int
+	queue   []*message
+	onReady func()
+
+	canceled bool
+	closing  bool // 已调用 Return 或 Error，等待缓存发送完毕
+	closed   bool
+}
+
+func (ss *Service) openStream(ctx *rpcContext, mReq *message) {
+	window := int(mReq.credit)
+	if window <= 0 {
+		window = defaultStreamWindow
+	}
+	st := &rpcStream{
+		ctx:    ctx,
+		key:    callKey{nAddr: mReq.nAddr, src: mReq.src, sess: mReq.sess},
+		window: window,
+		credit: window,
+	}
+	if ss.streams == nil {
+		ss.streams = make(map[callKey]*rpcStream)
+	}
+	ss.streams[st.key] = st
+	ctx.stream = st
+}
+
+// onStreamControl 处理调用方的窗口增加或取消流，于服务主线程中调用
+func (ss *Service) onStreamControl(m *message) {
+	defer m.clear()
+
+	st := ss.streams[callKey{nAddr: m.nAddr, src: m.src, sess: m.sess}]
+	if st == nil {
+		return
+	}
+
+	if m.flag&msgFlagStreamCancel != 0 {
+		st.cancel()
+		return
+	}
+	st.grant(int(m.credit))
+}
+
+func (ss *rpcStream) Send(args ...any) error {
+	if ss.canceled {
+		return ErrStreamCanceled
+	}
+	if ss.closing || ss.closed {
+		return ErrStreamClosed
+	}
+
+	if ss.credit <= 0 || len(ss.queue) > 0 {
+		if len(ss.queue) >= ss.window {
+			return ErrStreamFull
+		}
+	}
+
+	ctx := ss.ctx
+	m := &message{
+		nAddr: ctx.reqNodeAddr,
+		src:   ctx.srv.sAddr,
+		dst:   ctx.reqSrc,
+		sess:  -ctx.reqSess,
+		trace: ctx.mRsp.trace,
+		flag:  msgFlagStream,
+	}
+	m.writeResponse(args...)
+
+	if ss.credit <= 0 || len(ss.queue) > 0 {
+		ss.queue = append(ss.queue, m)
+		return nil
+	}
+	return ss.sendItem(m)
+}
+
+func (ss *rpcStream) OnReady(f func()) {
+	ss.onReady = f
+}
+
+func (ss *rpcStream) Canceled() bool {
+	return ss.canceled
+}
+
+func (ss *rpcStream) sendItem(m *message) error {
+	ss.credit--
+	if !ss.ctx.sendResponse(m) {
+		// 调用方已断开，不再发送
+		ss.cancel()
+		return ErrStreamCanceled
+	}
+	return nil
+}
+
+// grant 增加窗口并发送缓存的消息
+func (ss *rpcStream) grant(n int) {
+	if ss.canceled || ss.closed || n <= 0 {
+		return
+	}
+
+	ss.credit += n
+	for len(ss.queue) > 0 && ss.credit > 0 {
+		m := ss.queue[0]
+		ss.queue[0] = nil
+		ss.queue = ss.queue[1:]
+		if ss.sendItem(m) != nil {
+			return
+		}
+	}
+	if len(ss.queue) > 0 {
+		return
+	}
+
+	if ss.closing {
+		ss.ctx.flush()
+	} else if ss.onReady != nil {
+		ss.ctx.srv.withTrace(ss.ctx.mRsp.trace, ss.onReady)
+	}
+}
+
+// close 结束流，缓存发送完毕时返回 true，否则在发送完毕后再次调用 flush
+func (ss *rpcStream) close() bool {
+	ss.closing = true
+	if len(ss.queue) > 0 && !ss.canceled {
+		return false
+	}
+
+	ss.closed = true
+	ss.onReady = nil
+	if srv := ss.ctx.srv; srv.streams[ss.key] == ss {
+		delete(srv.streams, ss.key)
+	}
+	return true
+}
+
+// cancel 调用方取消或断开，丢弃缓存并以 ErrStreamCanceled 结束会话
+func (ss *rpcStream) cancel() {
+	if ss.canceled || ss.closed {
+		return
+	}
+	ss.canceled = true
+	for _, m := range ss.queue {
+		m.clear()
+	}
+	ss.queue = nil
+	ss.ctx.Error(ErrStreamCanceled)
+}
+
+var _ IStreamPromise = (*streamCall)(nil)
+
+// streamCall 调用方的流式调用，回调均在服务主线程执行
+type streamCall struct {
+	proxy      *serviceProxy
+	fName      string
+	args       []any
+	nextCb     any
+	completeCb func()
+	errCb      func(error)
+	finalCb    func()
+	timeout    time.Duration
+	window     int
+
+	srv       *Service
+	sender    iMessageSender
+	dst       int32
+	sess      int32
+	trace     int64
+	consumed  int
+	lastRecv  time.Time
+	idleTimer ITimeWheelHandle
+	started   bool
+	done      bool
+}
+
+// CallStream 发起流式调用，仅支持节点内及节点间的服务代理
+//
+//	node.CallStream(proxy, "DumpRank", 100).
+//		OnNext(func(rank int, name string) { ... }).
+//		OnComplete(func() { ... }).
+//		Catch(func(err error) { ... }).Done()
+func CallStream(proxy IProxy, fName string, args ...any) IStreamPromise {
+	sp, _ := proxy.(*serviceProxy)
+	return &streamCall{
+		proxy:   sp,
+		fName:   fName,
+		args:    args,
+		timeout: -1,
+	}
+}
+
+func (ss *streamCall) OnNext(f any) IStreamPromise {
+	ss.nextCb = f
+	return ss
+}
+
+func (ss *streamCall) OnComplete(f func()) IStreamPromise {
+	ss.completeCb = f
+	return ss
+}
+
+func (ss *streamCall) Catch(f func(error)) IStreamPromise {
+	ss.errCb = f
+	return ss
+}
+
+func (ss *streamCall) Final(f func()) IStreamPromise {
+	ss.finalCb = f
+	return ss
+}
+
+func (ss *streamCall) Timeout(timeout time.Duration) IStreamPromise {
+	ss.timeout = timeout
+	return ss
+}
+
+func (ss *streamCall) Window(n int) IStreamPromise {
+	ss.window = n
+	return ss
+}
+
+func (ss *streamCall) Done() {
+	if ss.started {
+		return
+	}
+	ss.started = true
+
+	sp := ss.proxy
+	if sp == nil || !sp.Avail() || sp.srv == nil {
+		if sp != nil && sp.srv != nil {
+			ss.srv = sp.srv
+		}
+		ss.failLater(ErrStreamNotSupported)
+		return
+	}
+
+	ss.srv = sp.srv
+	if ss.timeout == -1 {
+		ss.timeout = defaultStreamTimeout
+	}
+	ss.window = min(max(ss.window, 0), msgMaxCredit)
+	if ss.window == 0 {
+		ss.window = defaultStreamWindow
+	}
+	ss.trace = ss.srv.traceOrNew()
+
+	ss.sender = sp.getSender()
+	if ss.sender == nil {
+		ss.failLater(ErrServiceNotExist)
+		return
+	}
+
+	ss.dst = sp.sAddr
+	ss.sess = nodeGenSessionID()
+	m := &message{
+		src:    ss.srv.GetAddr(),
+		dst:    ss.dst,
+		sess:   ss.sess,
+		trace:  ss.trace,
+		flag:   msgFlagStream,
+		credit: int32(ss.window),
+	}
+	m.writeRequest(ss.fName, ss.args)
+	ss.args = nil
+
+	srv := ss.srv
+	m.cb = func(mm *message) {
+		srv.Fork("proxy.stream", func() {
+			ss.onMessage(mm)
+		})
+	}
+
+	ss.lastRecv = srv.GetTime()
+	ss.armIdleTimer(ss.timeout)
+	ss.sender.send(m)
+}
+
+func (ss *streamCall) Cancel() {
+	if !ss.started || ss.done || ss.sender == nil {
+		return
+	}
+	ss.sendControl(msgFlagStreamCancel, 0)
+	ss.finish(ErrStreamCanceled)
+}
+
+func (ss *streamCall) armIdleTimer(delay time.Duration) {
+	if ss.timeout <= 0 {
+		return
+	}
+	ss.idleTimer = ss.srv.After(delay, func() {
+		ss.idleTimer = nil
+		if ss.done {
+			return
+		}
+		if idle := ss.srv.GetTime().Sub(ss.lastRecv); idle < ss.timeout {
+			ss.armIdleTimer(ss.timeout - idle)
+			return
+		}
+		ss.sendControl(msgFlagStreamCancel, 0)
+		ss.finish(ErrRequestTimeoutLocal)
+	})
+}
+
+func (ss *streamCall) onMessage(mm *message) {
+	defer mm.clear()
+	if ss.done {
+		return
+	}
+	ss.lastRecv = ss.srv.GetTime()
+
+	if mm.src == 0 {
+		ss.finish(mm.getError())
+		return
+	}
+	if !mm.isStreamItem() {
+		ss.finish(nil)
+		return
+	}
+
+	// 之后的控制消息直接发往处理流的服务
+	ss.dst = mm.src
+	if err := ss.deliver(mm); err != nil {
+		// 丢失消息后流不再完整，取消流并以解码错误结束
+		ss.sendControl(msgFlagStreamCancel, 0)
+		ss.finish(err)
+		return
+	}
+
+	ss.consumed++
+	if ss.consumed >= max(ss.window/2, 1) {
+		ss.sendControl(msgFlagStreamAck, ss.consumed)
+		ss.consumed = 0
+	}
+}
+
+func (ss *streamCall) deliver(mm *message) error {
+	srv := ss.srv
+	fv := reflect.ValueOf(ss.nextCb)
+	if !fv.IsValid() {
+		return nil
+	}
+
+	fArgs, err := mm.getResponse(fv.Type())
+	if err != nil {
+		srv.Errorf("stream(%s:%v) response error: %+v", ss.fName, ss.sess, err)
+		return err
+	}
+
+	srv.withTrace(ss.trace, func() {
+		defer func() {
+			if e := recover(); e != nil {
+				srv.Errorf("stream(%s:%v) next got panic: %v => %v", ss.fName, ss.sess, e, string(debug.Stack()))
+			}
+		}()
+		fv.Call(fArgs)
+	})
+	return nil
+}
+
+func (ss *streamCall) sendControl(flag uint8, credit int) {
+	m := &message{
+		src:    ss.srv.GetAddr(),
+		dst:    ss.dst,
+		sess:   ss.sess,
+		trace:  ss.trace,
+		flag:   flag,
+		credit: int32(credit),
+	}
+	ss.sender.send(m)
+}
+
+func (ss *streamCall) failLater(err error) {
+	if ss.srv == nil {
+		ss.finish(err)
+		return
+	}
+	ss.srv.Fork("proxy.stream.err", func() {
+		ss.finish(err)
+	})
+}
+
+func (ss *streamCall) finish(err error) {
+	if ss.done {
+		return
+	}
+	ss.done = true
+	if ss.idleTimer != nil {
+		ss.idleTimer.Stop()
+		ss.idleTimer = nil
+	}
+
+	call := func(f func()) {
+		if ss.srv != nil {
+			ss.srv.withTrace(ss.trace, f)
+		} else {
+			f()
+		}
+	}
+	if err != nil {
+		if ss.errCb != nil {
+			call(func() { ss.errCb(err) })
+		} else if ss.srv != nil {
+			ss.srv.Errorf("stream(%s:%v) uncatched error: %+v", ss.fName, ss.sess, err)
+		}
+	} else if ss.completeCb != nil {
+		call(ss.completeCb)
+	}
+	if ss.finalCb != nil {
+		call(ss.finalCb)
+	}
+
+	ss.nextCb, ss.completeCb, ss.errCb, ss.finalCb = nil, nil, nil, nil
+}
@@ -0,0 +1,206 @@
+package node
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type streamTestService struct {
+	Service
+	streams []IRpcStream
+}
+
+func (ss *streamTestService) RpcCount(ctx IRpcContext, n int) {
+	st := ctx.Stream()
+	ss.streams = append(ss.streams, st)
+
+	i := 0
+	produce := func() {
+		for ; i < n; i++ {
+			if err := st.Send(i); err != nil {
+				return
+			}
+		}
+		ctx.Return()
+	}
+	st.OnReady(produce)
+	produce()
+}
+
+func newStreamTestPair(t *testing.T) (*Service, *streamTestService, *serviceProxy) {
+	previousNode := gNode
+	t.Cleanup(func() { gNode = previousNode })
+	gNode = &Node{}
+
+	caller, _ := newPolicyTestService()
+	caller.sAddr = 1
+
+	callee := &streamTestService{}
+	callee.node = caller.node
+	callee.logger = testLogger{}
+	callee.tw = caller.tw
+	callee.sAddr = 2
+	callee.realSrv = callee
+	callee.methodMap = map[string]reflect.Value{
+		"Count": reflect.ValueOf((*streamTestService).RpcCount),
+	}
+
+	proxy := &serviceProxy{srv: caller, sAddr: 2, sender: &callee.Service}
+	return caller, callee, proxy
+}
+
+func pumpStream(services ...*Service) {
+	for range 20 {
+		for _, srv := range services {
+			srv.onTick()
+		}
+	}
+}
+
+func TestStreamDeliversItemsWithFlowControl(t *testing.T) {
+	caller, callee, proxy := newStreamTestPair(t)
+
+	var items []int
+	completed, finals := 0, 0
+	CallStream(proxy, "Count", 10).
+		Window(2).
+		OnNext(func(i int) { items = append(items, i) }).
+		OnComplete(func() { completed++ }).
+		Catch(func(err error) { t.Errorf("unexpected error: %v", err) }).
+		Final(func() { finals++ }).
+		Done()
+
+	// 窗口用尽后消息缓存在被调用方，缓存满后 Send 失败
+	callee.onTick()
+	st := callee.streams[0].(*rpcStream)
+	require.Zero(t, st.credit)
+	require.Len(t, st.queue, 2)
+
+	pumpStream(&callee.Service, caller)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, items)
+	require.Equal(t, 1, completed)
+	require.Equal(t, 1, finals)
+	require.Empty(t, callee.streams[0].(*rpcStream).queue)
+	require.Empty(t, callee.Service.streams)
+}
+
+func TestStreamCancelStopsProducer(t *testing.T) {
+	caller, callee, proxy := newStreamTestPair(t)
+
+	var items []int
+	var errs []error
+	sc := CallStream(proxy, "Count", 100).
+		Window(4).
+		OnNext(func(i int) { items = append(items, i) }).
+		Catch(func(err error) { errs = append(errs, err) })
+	sc.Done()
+	callee.onTick()
+	caller.onTick()
+	require.Equal(t, []int{0, 1, 2, 3}, items)
+
+	sc.Cancel()
+	require.Equal(t, []error{ErrStreamCanceled}, errs)
+	pumpStream(&callee.Service, caller)
+
+	st := callee.streams[0]
+	require.True(t, st.Canceled())
+	require.Equal(t, ErrStreamCanceled, st.Send(1))
+	require.Empty(t, callee.Service.streams)
+	require.Equal(t, []int{0, 1, 2, 3}, items)
+	require.Len(t, errs, 1)
+}
+
+func TestStreamMessageHeaderRoundTrip(t *testing.T) {
+	req := &message{src: 1, dst: 2, sess: 3, trace: 4, flag: msgFlagStream, credit: 64}
+	req.writeRequest("Count", []any{10})
+	bs, err := req.marshal()
+	require.NoError(t, err)
+
+	m := &message{}
+	require.NoError(t, m.unmarshal(bs))
+	require.Equal(t, uint8(msgFlagStream), m.flag)
+	require.Equal(t, int32(64), m.credit)
+	require.False(t, m.isControl())
+
+	ack := &message{src: 1, dst: 2, sess: 3, flag: msgFlagStreamAck, credit: msgMaxCredit}
+	bs, err = ack.marshal()
+	require.NoError(t, err)
+	require.Len(t, bs, messageHeaderLen)
+	m = &message{}
+	require.NoError(t, m.unmarshal(bs))
+	require.True(t, m.isControl())
+	require.Equal(t, int32(msgMaxCredit), m.credit)
+
+	item := &message{src: 2, dst: 1, sess: -3, flag: msgFlagStream}
+	item.writeResponse(7)
+	bs, err = item.marshal()
+	require.NoError(t, err)
+	m = &message{}
+	require.NoError(t, m.unmarshal(bs))
+	require.True(t, m.isStreamItem())
+}
+
+func TestStreamCancelReleasesRemoteSession(t *testing.T) {
+	caller, _, _ := newStreamTestPair(t)
+	caller.node.nodeOpt = &Option{}
+
+	// 被调用方已停止，流的请求不会得到任何响应
+	nAddr, err := NewNodeAddr("127.0.0.1", 9001)
+	require.NoError(t, err)
+	h := &remoteHandle{node: caller.node, nAddr: nAddr}
+	proxy := &serviceProxy{srv: caller, nAddr: nAddr, sAddr: 2, sender: h}
+
+	var errs []error
+	sc := CallStream(proxy, "Count", 100).Catch(func(err error) { errs = append(errs, err) })
+	sc.Done()
+	require.Equal(t, 1, syncMapLen(&h.sessCb))
+
+	sc.Cancel()
+	require.Equal(t, []error{ErrStreamCanceled}, errs)
+	require.Zero(t, syncMapLen(&h.sessCb))
+}
+
+func syncMapLen(m *sync.Map) int {
+	n := 0
+	m.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestStreamUndecodableItemFailsStream(t *testing.T) {
+	caller, callee, proxy := newStreamTestPair(t)
+
+	var items []string
+	var errs []error
+	completed, finals := 0, 0
+	sc := CallStream(proxy, "Count", 10).
+		Window(2).
+		OnNext(func(s string) { items = append(items, s) }).
+		OnComplete(func() { completed++ }).
+		Catch(func(err error) { errs = append(errs, err) }).
+		Final(func() { finals++ })
+	sc.Done()
+	callee.onTick()
+
+	// 远程节点的消息经过编码，类型不符时解码失败
+	call := sc.(*streamCall)
+	m := &message{src: 2, dst: 1, sess: -call.sess, flag: msgFlagStream}
+	m.writeResponse(1)
+	call.onMessage(reencode(t, m))
+
+	require.Empty(t, items)
+	require.Len(t, errs, 1)
+	require.Zero(t, completed)
+	require.Equal(t, 1, finals)
+
+	pumpStream(&callee.Service, caller)
+	require.True(t, callee.streams[0].Canceled())
+	require.Empty(t, callee.Service.streams)
+	require.Empty(t, items)
+	require.Len(t, errs, 1)
+}
@@ -0,0 +1,209 @@
+package node
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mogud/snow/core/host"
+	"github.com/mogud/snow/core/injection"
+	"github.com/mogud/snow/core/task"
+)
+
+// SupervisorStrategy 服务崩溃后的重启策略
+type SupervisorStrategy int
+
+const (
+	SupervisorOneForOne SupervisorStrategy = iota // 仅重启崩溃的服务
+	SupervisorOneForAll                           // 按启动的逆序关闭当前节点配置的全部服务，再按顺序重新启动
+)
+
+// SupervisorOption 服务的监督策略，仅作用于当前节点配置中启动的服务实例，重启后的实例以空参数调用 Start
+type SupervisorOption struct {
+	MaxPanics     int                // PanicWindow 内 panic 达到该次数视为崩溃，默认 3；Start 中 panic 直接视为崩溃
+	PanicWindow   time.Duration      // 统计 panic 的时间窗口，默认 1 分钟
+	Strategy      SupervisorStrategy // 重启策略
+	MaxRestarts   int                // RestartWindow 内最大重启次数，超过后不再重启并关闭整个进程，默认 3
+	RestartWindow time.Duration      // 统计重启的时间窗口，默认 1 分钟
+}
+
+// WithSupervisor 设置服务的监督策略，未设置时服务崩溃不重启
+func (ss *ServiceRegisterInfo) WithSupervisor(opt *SupervisorOption) *ServiceRegisterInfo {
+	o := *opt
+	if o.MaxPanics <= 0 {
+		o.MaxPanics = 3
+	}
+	if o.PanicWindow <= 0 {
+		o.PanicWindow = time.Minute
+	}
+	if o.MaxRestarts <= 0 {
+		o.MaxRestarts = 3
+	}
+	if o.RestartWindow <= 0 {
+		o.RestartWindow = time.Minute
+	}
+	ss.Supervisor = &o
+	return ss
+}
+
+// onPanic 记录服务主线程及协程中恢复的 panic，v 为恢复的值，达到阈值时视为崩溃，须在服务主线程调用
+func (ss *Service) onPanic(v any) {
+	opt := ss.supervisor
+	if opt == nil || ss.crashed {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	since := now - int64(opt.PanicWindow)
+	i := 0
+	for i < len(ss.panics) && ss.panics[i] <= since {
+		i++
+	}
+	ss.panics = append(ss.panics[i:], now)
+	if len(ss.panics) < opt.MaxPanics {
+		return
+	}
+
+	ss.crashed = true
+	ss.Errorf("service crashed after %d panics in %v, last: %v", len(ss.panics), opt.PanicWindow, v)
+	ss.node.supervisor.onCrash(ss, true)
+}
+
+// supervisor 按服务的监督策略重启崩溃的服务，重启过程串行执行
+type supervisor struct {
+	node     *Node
+	escalate func() // 重启次数超过限制时调用
+
+	lock     sync.Mutex
+	stopped  bool
+	restarts map[string][]time.Time // 服务名：窗口内的重启时间
+}
+
+func newSupervisor(node *Node, provider injection.IRoutineProvider) *supervisor {
+	return &supervisor{
+		node: node,
+		escalate: func() {
+			host.GetRoutine[host.IHostApplication](provider).StopApplication()
+		},
+		restarts: make(map[string][]time.Time),
+	}
+}
+
+// stop 节点关闭时停止监督，等待进行中的重启完成
+func (ss *supervisor) stop() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	ss.stopped = true
+}
+
+// onCrash 服务崩溃，ticking 代表服务已在运行；仅重启当前节点配置启动的实例，线程安全
+func (ss *supervisor) onCrash(srv *Service, ticking bool) {
+	task.Execute(func() {
+		ss.lock.Lock()
+		defer ss.lock.Unlock()
+
+		name := srv.name
+		if ss.stopped || ss.node.configuredAddr(name) != srv.sAddr {
+			return
+		}
+
+		opt := srv.supervisor
+		if !ss.allow(name, opt) {
+			ss.node.logger.Errorf("service(%s) restarted too many times in %v, shutting down", name, opt.RestartWindow)
+			ss.stopped = true
+			task.Execute(ss.escalate)
+			return
+		}
+
+		if mc := ss.node.regOpt.MetricCollector; mc != nil {
+			mc.Counter("[Supervisor] restart "+name, 1)
+		}
+
+		if !ticking {
+			ss.node.discardService(srv)
+		}
+		if opt.Strategy == SupervisorOneForAll {
+			ss.restartAll()
+		} else {
+			ss.restart(name)
+		}
+	})
+}
+
+// allow 记录一次重启，返回是否未超过重启次数限制
+func (ss *supervisor) allow(name string, opt *SupervisorOption) bool {
+	now := time.Now()
+	list := ss.restarts[name]
+	i := 0
+	for i < len(list) && now.Sub(list[i]) >= opt.RestartWindow {
+		i++
+	}
+	list = append(list[i:], now)
+	ss.restarts[name] = list
+	return len(list) <= opt.MaxRestarts
+}
+
+func (ss *supervisor) restart(name string) {
+	if sAddr := ss.node.configuredAddr(name); sAddr != 0 {
+		StopService(sAddr)
+	}
+	ss.respawn(name)
+}
+
+func (ss *supervisor) restartAll() {
+	names := Config.CurNodeServices
+	for i := len(names) - 1; i >= 0; i-- {
+		if sAddr := ss.node.configuredAddr(names[i]); sAddr != 0 {
+			StopService(sAddr)
+		}
+	}
+	for _, name := range names {
+		ss.respawn(name)
+	}
+}
+
+// respawn 创建并启动服务的新实例，替换配置中的实例
+func (ss *supervisor) respawn(name string) {
+	sAddr, err := newService(name, true)
+	if err != nil {
+		ss.node.logger.Errorf("restart service(%s) error: %+v", name, err)
+		return
+	}
+
+	ss.node.Lock()
+	ss.node.name2Addr[name] = sAddr
+	ss.node.Unlock()
+
+	StartService(sAddr, nil)
+	ss.node.logger.Infof("service(%s:%#8x) restarted", name, sAddr)
+}
+
+// configuredAddr 当前节点配置启动的服务实例地址，不存在时返回 0，线程安全
+func (ss *Node) configuredAddr(name string) int32 {
+	ss.Lock()
+	defer ss.Unlock()
+
+	return ss.name2Addr[name]
+}
+
+// discardService 移除 Start 失败的服务实例，该实例未运行，不调用其 Stop 及 AfterStop；
+// 实例标记为已关闭，邮箱中的请求以 ErrServiceNotExist 失败，持有该实例的代理随后重新查找
+func (ss *Node) discardService(srv *Service) {
+	ss.Lock()
+	delete(ss.services, srv.sAddr)
+	if ss.services[-srv.kind] == srv {
+		delete(ss.services, -srv.kind)
+	}
+	ss.Unlock()
+
+	atomic.StoreInt32(&srv.closedLock, 2)
+	srv.msgBufferLock.Lock()
+	msgList := srv.msgBuffer
+	srv.msgBuffer = nil
+	srv.msgBufferLock.Unlock()
+	for _, m := range msgList {
+		srv.replyError(m, ErrServiceNotExist)
+		m.clear()
+	}
+}
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSupervisorTestService(opt *SupervisorOption) (*Service, chan struct{}) {
+	srv, _ := newBreakerTestService()
+	srv.name = "Room"
+	srv.sAddr = 5
+	srv.supervisor = (&ServiceRegisterInfo{}).WithSupervisor(opt).Supervisor
+
+	escalated := make(chan struct{}, 1)
+	node := srv.node
+	node.logger = testLogger{}
+	node.name2Addr = map[string]int32{"Room": 5}
+	node.supervisor = &supervisor{
+		node:     node,
+		escalate: func() { escalated <- struct{}{} },
+		restarts: map[string][]time.Time{},
+	}
+	return srv, escalated
+}
+
+func TestServiceCrashesAfterPanics(t *testing.T) {
+	srv, _ := newSupervisorTestService(&SupervisorOption{MaxPanics: 2, PanicWindow: time.Minute})
+	srv.node.supervisor.stop()
+
+	boom := func() { panic("boom") }
+	srv.doFunc(&tagFunc{Tag: "boom", F: boom})
+	require.False(t, srv.crashed)
+
+	// 窗口外的 panic 不计入
+	srv.panics[0] -= int64(2 * time.Minute)
+	srv.doFunc(&tagFunc{Tag: "boom", F: boom})
+	require.False(t, srv.crashed)
+	require.Len(t, srv.panics, 1)
+
+	srv.doFunc(&tagFunc{Tag: "boom", F: boom})
+	require.True(t, srv.crashed)
+
+	// 协程中的 panic 同样计入，包括挂起后恢复执行时的 panic
+	co, _ := newSupervisorTestService(&SupervisorOption{MaxPanics: 2, PanicWindow: time.Minute})
+	co.node.supervisor.stop()
+	now := time.Now()
+	co.tw = newTimeWheel(now, 10*time.Millisecond)
+	co.Go(func(Co) { boom() })
+	require.Len(t, co.panics, 1)
+	co.Go(func(c Co) {
+		_ = c.Sleep(50 * time.Millisecond)
+		boom()
+	})
+	require.False(t, co.crashed)
+	co.tw.update(now.Add(100 * time.Millisecond))
+	require.True(t, co.crashed)
+	require.Empty(t, co.coroutines)
+
+	// 未设置监督策略的服务不记录
+	plain, _ := newBreakerTestService()
+	plain.doFunc(&tagFunc{Tag: "boom", F: boom})
+	require.False(t, plain.crashed)
+	require.Empty(t, plain.panics)
+}
+
+func TestSupervisorRestartIntensity(t *testing.T) {
+	sup := &supervisor{restarts: map[string][]time.Time{}}
+	opt := &SupervisorOption{MaxRestarts: 2, RestartWindow: time.Minute}
+	require.True(t, sup.allow("Room", opt))
+	require.True(t, sup.allow("Room", opt))
+	require.False(t, sup.allow("Room", opt))
+	require.True(t, sup.allow("Hall", opt))
+
+	// 窗口外的重启不计入
+	list := sup.restarts["Room"]
+	for i := range list {
+		list[i] = list[i].Add(-2 * time.Minute)
+	}
+	require.True(t, sup.allow("Room", opt))
+}
+
+func TestSupervisorEscalatesWhenRestartsExceeded(t *testing.T) {
+	srv, escalated := newSupervisorTestService(&SupervisorOption{MaxPanics: 1, MaxRestarts: 1})
+	sup := srv.node.supervisor
+	sup.restarts["Room"] = []time.Time{time.Now()}
+
+	srv.doFunc(&tagFunc{Tag: "boom", F: func() { panic("boom") }})
+	select {
+	case <-escalated:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not escalate")
+	}
+
+	sup.lock.Lock()
+	defer sup.lock.Unlock()
+	require.True(t, sup.stopped)
+}
+
+func TestSupervisorIgnoresUnconfiguredInstance(t *testing.T) {
+	srv, escalated := newSupervisorTestService(&SupervisorOption{MaxPanics: 1, MaxRestarts: 1})
+	sup := srv.node.supervisor
+	sup.restarts["Room"] = []time.Time{time.Now()}
+	srv.sAddr = 6
+
+	srv.doFunc(&tagFunc{Tag: "boom", F: func() { panic("boom") }})
+	require.True(t, srv.crashed)
+	select {
+	case <-escalated:
+		t.Fatal("unexpected escalation")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type startPanicService struct {
+	Service
+}
+
+func (ss *startPanicService) Start(any) {
+	panic("boom")
+}
+
+func TestUnsupervisedStartPanicDiscardsInstance(t *testing.T) {
+	base, _ := newBreakerTestService()
+	srv := &startPanicService{}
+	srv.node = base.node
+	srv.logger = testLogger{}
+	srv.name = "Room"
+	srv.kind = 3
+	srv.sAddr = 5
+	srv.realSrv = srv
+	srv.wg = &sync.WaitGroup{}
+	srv.node.services = map[int32]*Service{5: &srv.Service, -3: &srv.Service}
+
+	errs := make(chan error, 1)
+	require.True(t, srv.send(newTestRequest(1, "queued", func(m *message) { errs <- m.getError() })))
+
+	// 排队的请求立即失败，实例不再接收消息，启动方收到包含 panic 值的错误
+	started := make(chan error, 1)
+	srv.start(nil, func(err error) { started <- err })
+	select {
+	case err := <-errs:
+		require.Equal(t, ErrServiceNotExist, err)
+	case <-time.After(time.Second):
+		t.Fatal("queued request not failed")
+	}
+	select {
+	case err := <-started:
+		require.ErrorIs(t, err, ErrServiceStartFailed)
+		require.ErrorContains(t, err, "boom")
+	case <-time.After(time.Second):
+		t.Fatal("start result not reported")
+	}
+	require.True(t, srv.closed())
+	srv.node.Lock()
+	require.Empty(t, srv.node.services)
+	srv.node.Unlock()
+	require.False(t, srv.send(newTestPost("late")))
+}
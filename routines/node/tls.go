@@ -0,0 +1,168 @@
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mogud/snow/core/logging/slog"
+)
+
+// tlsReloadCheckInterval 证书文件变更检查的最小间隔
+const tlsReloadCheckInterval = time.Second
+
+// tlsReloader 节点 Tcp 连接的 TLS 配置，证书文件修改后在下一次握手时自动重新加载
+type tlsReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	serverName string
+	clientAuth bool
+
+	lock      sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  [3]time.Time
+	lastCheck time.Time
+}
+
+func newTlsReloader(opt *Option) (*tlsReloader, error) {
+	if len(opt.TlsCertFile) == 0 && len(opt.TlsKeyFile) == 0 {
+		return nil, nil
+	}
+	if len(opt.TlsCertFile) == 0 || len(opt.TlsKeyFile) == 0 {
+		return nil, fmt.Errorf("both TlsCertFile and TlsKeyFile must be set")
+	}
+
+	ss := &tlsReloader{
+		certFile:   opt.TlsCertFile,
+		keyFile:    opt.TlsKeyFile,
+		caFile:     opt.TlsCAFile,
+		serverName: opt.TlsServerName,
+		clientAuth: opt.TlsClientAuth,
+	}
+	modTimes, err := ss.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err = ss.load(modTimes); err != nil {
+		return nil, err
+	}
+	ss.lastCheck = time.Now()
+	return ss, nil
+}
+
+// serverConfig 接收连接时使用的配置，每次握手获取最新的证书
+func (ss *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := ss.current()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if ss.clientAuth {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// clientConfig 发起连接时使用的配置，serverName 为空时使用连接地址的主机部分
+func (ss *tlsReloader) clientConfig(addr string) *tls.Config {
+	cert, pool := ss.current()
+
+	serverName := ss.serverName
+	if len(serverName) == 0 {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    pool,
+	}
+	if ss.clientAuth {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return cfg
+}
+
+func (ss *tlsReloader) current() (*tls.Certificate, *x509.CertPool) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if now := time.Now(); now.Sub(ss.lastCheck) >= tlsReloadCheckInterval {
+		ss.lastCheck = now
+
+		modTimes, err := ss.statFiles()
+		if err != nil {
+			slog.Errorf("node tls stat certificate files error: %v", err)
+		} else if modTimes != ss.modTimes {
+			if err = ss.load(modTimes); err != nil {
+				// 加载失败时继续使用旧证书
+				slog.Errorf("node tls reload certificate error: %v", err)
+			} else {
+				slog.Infof("node tls certificate reloaded")
+			}
+		}
+	}
+	return ss.cert, ss.pool
+}
+
+func (ss *tlsReloader) statFiles() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, f := range []string{ss.certFile, ss.keyFile, ss.caFile} {
+		if len(f) == 0 {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (ss *tlsReloader) load(modTimes [3]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(ss.certFile, ss.keyFile)
+	if err != nil {
+		return err
+	}
+
+	// CA 为空时使用系统根证书
+	var pool *x509.CertPool
+	if len(ss.caFile) > 0 {
+		bs, err := os.ReadFile(ss.caFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return fmt.Errorf("no certificate found in %v", ss.caFile)
+		}
+	}
+
+	ss.cert = &cert
+	ss.pool = pool
+	ss.modTimes = modTimes
+	return nil
+}
+
+// tlsHandshake 在超时时间内完成 TLS 握手
+func tlsHandshake(conn *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	return conn.HandshakeContext(ctx)
+}
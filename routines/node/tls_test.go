@@ -0,0 +1,127 @@
+package node
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTlsReloaderMutualHandshakeAndReload(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeTestCA(t, dir)
+	writeTestLeaf(t, dir, caCert, caKey, "node-1")
+
+	opt := &Option{
+		TlsCertFile:   filepath.Join(dir, "node.crt"),
+		TlsKeyFile:    filepath.Join(dir, "node.key"),
+		TlsCAFile:     filepath.Join(dir, "ca.crt"),
+		TlsClientAuth: true,
+	}
+	reloader, err := newTlsReloader(opt)
+	require.NoError(t, err)
+
+	peer := tlsTestHandshake(t, reloader)
+	require.Equal(t, "node-1", peer)
+
+	// 重写证书文件并使修改时间变化，下一次握手应使用新证书
+	writeTestLeaf(t, dir, caCert, caKey, "node-2")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(opt.TlsCertFile, later, later))
+	reloader.lastCheck = time.Time{}
+
+	peer = tlsTestHandshake(t, reloader)
+	require.Equal(t, "node-2", peer)
+}
+
+func TestTlsReloaderDisabledWithoutCertificate(t *testing.T) {
+	reloader, err := newTlsReloader(&Option{})
+	require.NoError(t, err)
+	require.Nil(t, reloader)
+
+	_, err = newTlsReloader(&Option{TlsCertFile: "node.crt"})
+	require.Error(t, err)
+}
+
+// tlsTestHandshake 完成一次双向认证握手，返回服务端看到的客户端证书名称
+func tlsTestHandshake(t *testing.T, reloader *tlsReloader) string {
+	t.Helper()
+	client, server := loopbackTCPPair(t)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	sc := tls.Server(server, reloader.serverConfig())
+	done := make(chan error, 1)
+	go func() {
+		done <- tlsHandshake(sc)
+	}()
+
+	cc := tls.Client(client, reloader.clientConfig(client.RemoteAddr().String()))
+	require.NoError(t, tlsHandshake(cc))
+	require.NoError(t, <-done)
+	return sc.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func writeTestCA(t *testing.T, dir string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "snow-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	writeTestPem(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", der)
+	return cert, key
+}
+
+func writeTestLeaf(t *testing.T, dir string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writeTestPem(t, filepath.Join(dir, "node.crt"), "CERTIFICATE", der)
+	writeTestPem(t, filepath.Join(dir, "node.key"), "EC PRIVATE KEY", keyDer)
+}
+
+func writeTestPem(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+}
@@ -0,0 +1,166 @@
+package node
+
+import (
+	"bufio"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mogud/snow/core/logging/slog"
+)
+
+// httpTraceHeader HTTP RPC 中携带追踪 ID 的请求头，值为 16 进制
+const httpTraceHeader = "X-Snow-Trace-Id"
+
+const (
+	SpanKindRpc  = "rpc"
+	SpanKindPost = "post"
+	SpanKindHttp = "http"
+)
+
+// Span 一次 RPC 在被调用方的执行记录
+type Span struct {
+	TraceID  string        `json:"TraceID"`  // 追踪 ID，16 进制
+	Node     string        `json:"Node"`     // 被调用方节点名
+	Service  string        `json:"Service"`  // 被调用方服务名
+	Method   string        `json:"Method"`   // 被调用方法名，不含 "Rpc" 或 "HttpRpc" 头
+	Kind     string        `json:"Kind"`     // 调用类型：rpc、post 或 http
+	Remote   string        `json:"Remote"`   // 调用方节点地址，本地调用为空
+	Start    time.Time     `json:"Start"`    // 开始处理时间
+	Duration time.Duration `json:"Duration"` // 从开始处理到返回的耗时
+	Error    string        `json:"Error"`    // 错误信息，成功时为空
+}
+
+// ISpanExporter Span 导出器，Export 可能在任意线程调用，实现需保证线程安全且不阻塞
+type ISpanExporter interface {
+	Export(span *Span)
+}
+
+// newTraceID 生成非 0 的追踪 ID
+func newTraceID() int64 {
+	for {
+		if id := rand.Int64(); id != 0 {
+			return id
+		}
+	}
+}
+
+// orNewTraceID id 为 0 时生成新的追踪 ID
+func orNewTraceID(id int64) int64 {
+	if id == 0 {
+		return newTraceID()
+	}
+	return id
+}
+
+// traceOrNew 当前处于调用链中则沿用其追踪 ID，否则开启新的调用链
+func (ss *Service) traceOrNew() int64 {
+	return orNewTraceID(ss.GetTraceID())
+}
+
+func parseTraceID(s string) int64 {
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(id)
+}
+
+var _ ISpanExporter = (*JsonlSpanExporter)(nil)
+
+// JsonlSpanExporter 将 Span 以每行一个 JSON 的格式追加写入文件
+type JsonlSpanExporter struct {
+	file   *os.File
+	ch     chan *Span    // 待写入的 Span，不关闭，关闭后导出的 Span 直接丢弃
+	stop   chan struct{} // Close 时关闭
+	closed chan struct{} // 写入结束后关闭
+	once   sync.Once
+}
+
+// NewJsonlSpanExporter 创建 JSONL 文件导出器，bufferSize 为待写入 Span 的队列长度，队列满时丢弃新的 Span
+func NewJsonlSpanExporter(path string, bufferSize int) (*JsonlSpanExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if bufferSize <= 0 {
+		bufferSize = 4096
+	}
+	ss := &JsonlSpanExporter{
+		file:   f,
+		ch:     make(chan *Span, bufferSize),
+		stop:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go ss.run()
+	return ss, nil
+}
+
+// Export 将 Span 加入写入队列，队列满或已关闭时丢弃，可在 Close 之后调用
+func (ss *JsonlSpanExporter) Export(span *Span) {
+	select {
+	case <-ss.stop:
+		return
+	default:
+	}
+
+	select {
+	case ss.ch <- span:
+	default:
+	}
+}
+
+// Close 写入队列中剩余的 Span 并关闭文件
+func (ss *JsonlSpanExporter) Close() {
+	ss.once.Do(func() {
+		close(ss.stop)
+	})
+	<-ss.closed
+}
+
+func (ss *JsonlSpanExporter) run() {
+	defer close(ss.closed)
+
+	w := bufio.NewWriter(ss.file)
+	flush := func() {
+		if err := w.Flush(); err != nil {
+			slog.Errorf("span exporter flush error: %+v", err)
+		}
+	}
+
+	write := func(span *Span) {
+		bs, err := jsoniter.Marshal(span)
+		if err != nil {
+			slog.Errorf("span marshal error: %+v", err)
+			return
+		}
+		_, _ = w.Write(bs)
+		_ = w.WriteByte('\n')
+	}
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case span := <-ss.ch:
+			write(span)
+		case <-t.C:
+			flush()
+		case <-ss.stop:
+			for {
+				select {
+				case span := <-ss.ch:
+					write(span)
+				default:
+					flush()
+					_ = ss.file.Close()
+					return
+				}
+			}
+		}
+	}
+}
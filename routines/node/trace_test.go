@@ -0,0 +1,65 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mogud/snow/core/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyPropagatesCurrentTraceID(t *testing.T) {
+	target := &Service{}
+	proxy := newOrderTestProxy(target)
+
+	proxy.srv.withTrace(0x1234, func() {
+		proxy.Call("inherited").Done()
+	})
+	proxy.Call("fresh").Done()
+
+	target.msgBufferLock.Lock()
+	messages := append([]*message(nil), target.msgBuffer...)
+	target.msgBufferLock.Unlock()
+
+	require.Len(t, messages, 2)
+	require.Equal(t, int64(0x1234), messages[0].trace)
+	require.NotZero(t, messages[1].trace)
+	require.NotEqual(t, int64(0x1234), messages[1].trace)
+	require.Zero(t, proxy.srv.GetTraceID())
+}
+
+func TestJsonlSpanExporterWritesOneSpanPerLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewJsonlSpanExporter(path, 16)
+	require.NoError(t, err)
+
+	exporter.Export(&Span{TraceID: logging.FormatTraceID(-1), Service: "Pong", Method: "Hello", Kind: SpanKindRpc, Duration: time.Millisecond})
+	exporter.Export(&Span{TraceID: logging.FormatTraceID(2), Service: "Pong", Method: "Bye", Kind: SpanKindPost, Error: "boom"})
+	exporter.Close()
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	require.Len(t, lines, 2)
+
+	var span Span
+	require.NoError(t, jsoniter.UnmarshalFromString(lines[0], &span))
+	require.Equal(t, int64(-1), parseTraceID(span.TraceID))
+	require.Equal(t, "Hello", span.Method)
+	require.NoError(t, jsoniter.UnmarshalFromString(lines[1], &span))
+	require.Equal(t, "boom", span.Error)
+	require.Equal(t, "0000000000000002", span.TraceID)
+}
+
+func TestJsonlSpanExporterDropsAfterClose(t *testing.T) {
+	exporter, err := NewJsonlSpanExporter(filepath.Join(t.TempDir(), "spans.jsonl"), 16)
+	require.NoError(t, err)
+	exporter.Close()
+
+	require.NotPanics(t, func() { exporter.Export(&Span{Service: "Pong"}) })
+	exporter.Close()
+}